@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"wander/instance"
+	"wander/model"
+)
+
+// 退出码，便于脚本区分错误类型
+const (
+	ExitOK       = 0
+	ExitError    = 1 // 其他错误
+	ExitUsage    = 2 // 参数错误
+	ExitNetwork  = 3 // 网络错误
+	ExitNotFound = 4 // 歌曲、歌单等不存在
+	ExitDecode   = 5 // 响应或文件解析失败
+)
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(c *context, args []string) error
+}
+
+var commands = []command{
+	{"charts", "", "列出榜单及歌单", runCharts},
+	{"list", "<playlist-id>", "列出歌单中的歌曲", runList},
+	{"search", "<keyword>", "搜索歌曲、歌手、专辑或歌单", runSearch},
+	{"download", "<id|playlist>", "下载歌曲或整个歌单到缓存目录", runDownload},
+	{"play", "<id|file|m3u>", "在命令行播放歌曲、本地文件或播放列表", runPlay},
+	{"daemon", "", "以后台服务运行，通过HTTP接口控制", runDaemon},
+	{"next", "", "正在运行的实例切换到下一首", runForward},
+	{"prev", "", "正在运行的实例切换到上一首", runForward},
+	{"toggle", "", "正在运行的实例播放/暂停", runForward},
+	{"pause", "", "正在运行的实例暂停", runForward},
+	{"stop", "", "正在运行的实例停止播放", runForward},
+}
+
+func init() {
+	instance.ExitCode = ExitCode
+}
+
+// 命令执行上下文
+type context struct {
+	flags  *flag.FlagSet
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// 参数错误
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func find(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// name是否为子命令
+func IsCommand(name string) bool {
+	return name == "help" || find(name) != nil
+}
+
+// 执行子命令，返回退出码
+func Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(os.Stdout)
+		return ExitOK
+	}
+	cmd := find(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		usage(os.Stderr)
+		return ExitUsage
+	}
+
+	c := &context{
+		flags:  flag.NewFlagSet(cmd.name, flag.ContinueOnError),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	c.flags.BoolVar(&c.json, "json", false, "以JSON格式输出")
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: wander %s [flags] %s\n", cmd.name, cmd.args)
+		c.flags.PrintDefaults()
+	}
+
+	err := cmd.run(c, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		c.fail(err)
+	}
+	return ExitCode(err)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: wander [-tui] [id|file|m3u]")
+	fmt.Fprintln(w, "       wander <command> [-json] [args]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.usage)
+	}
+	tw.Flush()
+}
+
+// 错误对应的退出码
+func ExitCode(err error) int {
+	var (
+		ue *usageError
+		re *instance.RemoteError
+	)
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &re):
+		return re.Code
+	case errors.As(err, &ue), errors.Is(err, model.ErrInvalidPlaylist):
+		return ExitUsage
+	case model.IsNetworkError(err):
+		return ExitNetwork
+	case errors.Is(err, model.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return ExitNotFound
+	case model.IsDecodeError(err):
+		return ExitDecode
+	}
+	return ExitError
+}
+
+// 解析参数，要求正好有n个位置参数
+func (c *context) parse(args []string, n int) ([]string, error) {
+	if err := c.flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &usageError{err.Error()}
+	}
+	if c.flags.NArg() != n {
+		c.flags.Usage()
+		return nil, &usageError{fmt.Sprintf("%s: expect %d argument(s), got %d", c.flags.Name(), n, c.flags.NArg())}
+	}
+	return c.flags.Args(), nil
+}
+
+// JSON模式下输出一个JSON对象，否则调用text输出文本
+func (c *context) print(v interface{}, text func(w io.Writer)) {
+	if c.json {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(v)
+		return
+	}
+	tw := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	text(tw)
+	tw.Flush()
+}
+
+func (c *context) fail(err error) {
+	if c.json {
+		enc := json.NewEncoder(c.stderr)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+		}{err.Error(), ExitCode(err)})
+		return
+	}
+	fmt.Fprintln(c.stderr, "error:", err)
+}
@@ -0,0 +1,392 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+	"wander/daemon"
+	"wander/instance"
+	"wander/model"
+)
+
+type chartOutput struct {
+	ID     string             `json:"id"`
+	Name   string             `json:"name"`
+	Kind   model.PlaylistKind `json:"kind"`
+	Tracks int                `json:"tracks,omitempty"`
+}
+
+type listOutput struct {
+	ID     string            `json:"id"`
+	Tracks []model.MusicInfo `json:"tracks"`
+}
+
+type searchOutput struct {
+	Keyword string             `json:"keyword"`
+	Type    string             `json:"type"`
+	Page    int                `json:"page"`
+	Pages   int                `json:"pages"`
+	Total   int                `json:"total"`
+	Tracks  []model.MusicInfo  `json:"tracks,omitempty"`
+	Items   []model.SearchItem `json:"items,omitempty"`
+}
+
+// download、play逐首输出的事件
+type trackEvent struct {
+	Event string          `json:"event"`
+	Index int             `json:"index"`
+	Total int             `json:"total"`
+	Track model.MusicInfo `json:"track"`
+	Error string          `json:"error,omitempty"`
+}
+
+func infos(musics []*model.Music) []model.MusicInfo {
+	res := make([]model.MusicInfo, 0, len(musics))
+	for _, m := range musics {
+		res = append(res, m.Info)
+	}
+	return res
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "--:--"
+	}
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+func printTracks(w io.Writer, tracks []model.MusicInfo) {
+	fmt.Fprintln(w, "#\tNAME\tARTIST\tALBUM\tTIME\tID")
+	for i, t := range tracks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, t.Name, t.ArtistsName, t.AlbumName, formatDuration(t.Duration), t.ID)
+	}
+}
+
+func runCharts(c *context, args []string) error {
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+	store, err := model.NewPlaylistStore()
+	if err != nil {
+		return err
+	}
+	favorites, err := model.NewFavoriteStore()
+	if err != nil {
+		return err
+	}
+	store.AttachFavorites(favorites)
+
+	var charts []chartOutput
+	for _, p := range store.List() {
+		charts = append(charts, chartOutput{ID: p.ID, Name: p.Name, Kind: p.Kind, Tracks: len(p.Tracks)})
+	}
+	c.print(charts, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tKIND")
+		for _, p := range charts {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.ID, p.Name, p.Kind)
+		}
+	})
+	return nil
+}
+
+func loadPlaylist(idOrUrl string) (string, []*model.Music, error) {
+	store, err := model.NewPlaylistStore()
+	if err != nil {
+		return "", nil, err
+	}
+	favorites, err := model.NewFavoriteStore()
+	if err != nil {
+		return "", nil, err
+	}
+	store.AttachFavorites(favorites)
+	return store.Load(idOrUrl)
+}
+
+func runList(c *context, args []string) error {
+	args, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	id, musics, err := loadPlaylist(args[0])
+	if err != nil {
+		return err
+	}
+	out := listOutput{ID: id, Tracks: infos(musics)}
+	c.print(out, func(w io.Writer) { printTracks(w, out.Tracks) })
+	return nil
+}
+
+func runSearch(c *context, args []string) error {
+	typ := c.flags.String("type", "song", "搜索类型: song, album, artist, playlist")
+	page := c.flags.Int("page", 1, "页码，从1开始")
+	limit := c.flags.Int("limit", model.DefaultSearchLimit, "每页数量")
+	args, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	st, ok := model.SearchTypeNames[*typ]
+	if !ok {
+		return &usageError{"unknown search type: " + *typ}
+	}
+	if *page < 1 {
+		return &usageError{"page must start from 1"}
+	}
+
+	res, err := model.Search(args[0], st, *page-1, *limit)
+	if err != nil {
+		return err
+	}
+	out := searchOutput{
+		Keyword: args[0],
+		Type:    *typ,
+		Page:    *page,
+		Pages:   res.Pages(),
+		Total:   res.Total,
+		Tracks:  infos(res.Musics),
+		Items:   res.Items,
+	}
+	c.print(out, func(w io.Writer) {
+		if st == model.SearchSong {
+			printTracks(w, out.Tracks)
+		} else {
+			fmt.Fprintln(w, "ID\tNAME\tOWNER\tSIZE")
+			for _, item := range out.Items {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", item.ID, item.Name, item.Owner, item.Size)
+			}
+		}
+		fmt.Fprintf(w, "\npage %d/%d, total %d\n", out.Page, out.Pages, out.Total)
+	})
+	return nil
+}
+
+func loadSong(id string) ([]*model.Music, error) {
+	music, err := model.RequestSong(id)
+	if err != nil {
+		return nil, err
+	}
+	return []*model.Music{music}, nil
+}
+
+func (c *context) event(ev trackEvent) {
+	c.print(ev, func(w io.Writer) {
+		status := ev.Event
+		if ev.Error != "" {
+			status += ": " + ev.Error
+		}
+		fmt.Fprintf(w, "[%d/%d] %s - %s\t%s\n", ev.Index+1, ev.Total, ev.Track.Name, ev.Track.ArtistsName, status)
+	})
+}
+
+func runDownload(c *context, args []string) error {
+	playlist := c.flags.Bool("playlist", false, "将参数视为歌单ID或链接")
+	lyric := c.flags.Bool("lyric", true, "同时下载歌词")
+	args, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	var musics []*model.Music
+	if *playlist || strings.Contains(args[0], "playlist") {
+		_, musics, err = loadPlaylist(args[0])
+	} else {
+		musics, err = loadSong(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll("cache", os.ModePerm); err != nil {
+		return err
+	}
+
+	// 逐首下载，失败的跳过，返回第一个错误
+	var first error
+	for i, music := range musics {
+		info := &music.Info
+		err := model.LoadMusic(info)
+		if err == nil && info.MusicPic != "" {
+			err = model.LoadPic(info)
+		}
+		if err == nil && *lyric && info.ID != "" {
+			_, err = model.LoadLyric(info)
+		}
+		ev := trackEvent{Event: "downloaded", Index: i, Total: len(musics), Track: *info}
+		if err != nil {
+			ev.Event, ev.Error = "failed", err.Error()
+			if first == nil {
+				first = err
+			}
+		}
+		c.event(ev)
+	}
+	return first
+}
+
+// 播放时收到的转发命令
+type playCtrl struct {
+	cmd    string
+	musics []*model.Music // play命令替换的播放列表
+}
+
+// 命令行播放时响应其他进程转发的命令
+type playController struct {
+	pm *model.PlayerManager
+	ch chan<- playCtrl
+}
+
+func (p playController) Play(target string) error {
+	musics, err := model.ResolveTracks(target)
+	if err != nil {
+		return err
+	}
+	p.ch <- playCtrl{cmd: instance.CmdPlay, musics: musics}
+	return nil
+}
+
+func (p playController) Next() error {
+	p.ch <- playCtrl{cmd: instance.CmdNext}
+	return nil
+}
+
+func (p playController) Prev() error {
+	p.ch <- playCtrl{cmd: instance.CmdPrev}
+	return nil
+}
+
+func (p playController) Toggle() error {
+	if p.pm.IsPlaying() {
+		p.pm.Play(nil, model.ActionPause, -1)
+	} else {
+		p.pm.Play(nil, model.ActionPlay, -1)
+	}
+	return nil
+}
+
+func (p playController) Pause() error {
+	p.pm.Play(nil, model.ActionPause, -1)
+	return nil
+}
+
+func (p playController) Stop() error {
+	p.ch <- playCtrl{cmd: instance.CmdStop}
+	return nil
+}
+
+func runPlay(c *context, args []string) error {
+	volume := c.flags.Int("volume", model.MaxVolume, "音量，0-100")
+	args, err := c.parse(args, 1)
+	if err != nil {
+		return err
+	}
+	// 已有实例在运行时交给它播放
+	if err = instance.Forward(instance.CmdPlay, args[0]); !errors.Is(err, instance.ErrNotRunning) {
+		return err
+	}
+	inst, err := instance.Acquire()
+	if err != nil {
+		return err
+	}
+	defer inst.Release()
+
+	musics, err := model.ResolveTracks(args[0])
+	if err != nil {
+		return err
+	}
+
+	pm := model.NewPlayerManager(nil)
+	pm.SetVolume(*volume)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	ctrl := make(chan playCtrl, 4)
+	go inst.Serve(playController{pm: pm, ch: ctrl})
+
+	// 依次播放，Ctrl+C或stop退出；全部无法播放时返回最后一个错误
+	var (
+		played  bool
+		lastErr error
+	)
+	for i := 0; i >= 0 && i < len(musics); {
+		music := musics[i]
+		ev := trackEvent{Event: "playing", Index: i, Total: len(musics), Track: music.Info}
+		if err := model.LoadMusic(&music.Info); err != nil {
+			ev.Event, ev.Error = "failed", err.Error()
+			c.event(ev)
+			lastErr = err
+			i++
+			continue
+		}
+		ev.Track = music.Info
+		if err := pm.Play(music, model.ActionPlay, -1); err != nil {
+			ev.Event, ev.Error = "failed", err.Error()
+			c.event(ev)
+			lastErr = err
+			i++
+			continue
+		}
+		c.event(ev)
+		played = true
+
+		r := waitEnd(pm, sig, ctrl)
+		switch r.cmd {
+		case instance.CmdPlay:
+			musics, i = r.musics, 0
+		case instance.CmdPrev:
+			if i > 0 {
+				i--
+			}
+		case instance.CmdStop:
+			i = -1
+		default:
+			i++
+		}
+	}
+	pm.Stop()
+	if played {
+		return nil
+	}
+	return lastErr
+}
+
+// 等待当前歌曲播放结束或收到切换命令，收到中断信号时返回stop
+func waitEnd(pm *model.PlayerManager, sig <-chan os.Signal, ctrl <-chan playCtrl) playCtrl {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sig:
+			return playCtrl{cmd: instance.CmdStop}
+		case r := <-ctrl:
+			return r
+		case <-ticker.C:
+			if pos, length := pm.Pos(), pm.Len(); length > 0 && pos >= length {
+				return playCtrl{cmd: instance.CmdNext}
+			}
+		}
+	}
+}
+
+// 把命令转发给正在运行的实例
+func runForward(c *context, args []string) error {
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+	return instance.Forward(c.flags.Name())
+}
+
+func runDaemon(c *context, args []string) error {
+	var opts daemon.Options
+	c.flags.StringVar(&opts.Addr, "listen", daemon.DefaultAddr, "监听地址，unix:<path>表示Unix socket")
+	c.flags.StringVar(&opts.MPDAddr, "mpd", "", "MPD协议监听地址，如127.0.0.1:6600，为空时不启用")
+	c.flags.StringVar(&opts.Token, "token", os.Getenv("WANDER_TOKEN"), "接口认证令牌，默认读取环境变量WANDER_TOKEN")
+	c.flags.BoolVar(&opts.MPRIS, "mpris", runtime.GOOS == "linux", "在D-Bus会话总线上注册MPRIS，仅Linux有效")
+	if _, err := c.parse(args, 0); err != nil {
+		return err
+	}
+	return daemon.Run(opts)
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"github.com/lauthrul/goutil/log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"wander/instance"
+)
+
+// 以后台服务方式运行，收到退出信号时保存播放状态
+func Run(opts Options) error {
+	inst, err := instance.Acquire()
+	if err != nil {
+		return err
+	}
+	defer inst.Release()
+
+	player := NewPlayer()
+	player.Restore()
+	server := NewServer(player, opts)
+
+	chErr := make(chan error, 2)
+	quit := make(chan struct{}, 1)
+	go func() {
+		chErr <- server.ListenAndServe()
+	}()
+	if opts.MPDAddr != "" {
+		// MPD客户端使用password命令认证
+		mpd := NewMPDServer(player, opts.Token)
+		go func() {
+			chErr <- mpd.ListenAndServe(opts.MPDAddr)
+		}()
+	}
+	if opts.MPRIS {
+		// 没有会话总线时不影响其他功能
+		err = StartMPRIS(player, func() {
+			select {
+			case quit <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			log.Error("start mpris err:", err)
+		}
+	}
+
+	go inst.Serve(remote{player})
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-chErr:
+			return err
+		case <-ticker.C:
+			if err := player.Save(); err != nil {
+				log.Error("save session err:", err)
+			}
+		case <-sig:
+			player.Stop()
+			return player.Save()
+		case <-quit:
+			player.Stop()
+			return player.Save()
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"github.com/lauthrul/goutil/log"
+	"sync"
+	"time"
+	"wander/model"
+)
+
+// 事件类型
+const (
+	EventSnapshot = "snapshot" // 连接时的完整状态
+	EventTrack    = "track"    // 切换歌曲
+	EventState    = "state"    // 播放、暂停、停止
+	EventPosition = "position" // 播放进度，每秒一次
+	EventStatus   = "status"   // 音量、播放模式等变化
+	EventQueue    = "queue"    // 队列变化
+	EventLyric    = "lyric"    // 当前歌词行
+	EventDownload = "download" // 下载进度
+	EventError    = "error"
+)
+
+// 推送的事件间隔
+const positionInterval = time.Second
+
+type Event struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+type Snapshot struct {
+	Status Status    `json:"status"`
+	Queue  QueueInfo `json:"queue"`
+}
+
+type trackEvent struct {
+	Index int             `json:"index"`
+	Track model.MusicInfo `json:"track"`
+}
+
+type stateEvent struct {
+	State string `json:"state"`
+}
+
+type positionEvent struct {
+	Position int64 `json:"position"`
+	Duration int64 `json:"duration"`
+}
+
+type errorEvent struct {
+	Error string `json:"error"`
+}
+
+// 事件分发。订阅者处理不及时时丢弃进度类事件；其他事件无法送达时关闭订阅，
+// 订阅者应重新订阅，从新的snapshot开始
+type hub struct {
+	mu   sync.Mutex
+	seq  int64
+	subs map[chan Event]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subs: map[chan Event]struct{}{}}
+}
+
+func (h *hub) subscribe(size int) chan Event {
+	ch := make(chan Event, size)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *hub) unsubscribe(ch <-chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub == ch {
+			delete(h.subs, sub)
+			close(sub)
+			return
+		}
+	}
+}
+
+func (h *hub) publish(typ string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev := Event{ID: h.seq, Type: typ, Time: time.Now(), Data: data}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			if droppable(typ) {
+				continue
+			}
+			log.Debug("close slow event subscriber, drop", typ)
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// 之后的事件会带上最新值，丢弃不影响状态
+func droppable(typ string) bool {
+	return typ == EventPosition || typ == EventDownload
+}
+
+// 订阅事件，返回订阅时的完整状态；先订阅再取状态，避免遗漏之间的变化。
+// 处理不及时时通道会被关闭，需重新订阅
+func (p *Player) Subscribe(size int) (<-chan Event, Event) {
+	ch := p.events.subscribe(size)
+	p.events.mu.Lock()
+	id := p.events.seq
+	p.events.mu.Unlock()
+	return ch, Event{ID: id, Type: EventSnapshot, Time: time.Now(), Data: p.Snapshot()}
+}
+
+func (p *Player) Unsubscribe(ch <-chan Event) {
+	p.events.unsubscribe(ch)
+}
+
+func (p *Player) Snapshot() Snapshot {
+	return Snapshot{Status: p.Status(), Queue: p.Queue()}
+}
+
+func (p *Player) publishQueue() {
+	p.events.publish(EventQueue, p.Queue())
+}
+
+func (p *Player) publishStatus() {
+	p.events.publish(EventStatus, p.Status())
+}
+
+func (p *Player) publishError(err error) {
+	p.events.publish(EventError, errorEvent{err.Error()})
+}
+
+// 将播放回调、下载进度转为事件，播放时每秒推送进度
+func (p *Player) pump() {
+	playback := p.pm.Subscribe(64)
+	model.OnDownloadProgress(func(progress model.DownloadProgress) {
+		p.events.publish(EventDownload, progress)
+	})
+	model.OnOfflineChanged(func(bool) {
+		p.publishStatus()
+	})
+
+	ticker := time.NewTicker(positionInterval)
+	defer ticker.Stop()
+	var trackID string
+	for {
+		select {
+		case cb := <-playback:
+			switch cb.Action {
+			case model.ActionPlay, model.ActionPause:
+				if id := cb.Info.ID + cb.Info.MusicLocal; id != trackID {
+					trackID = id
+					p.mu.Lock()
+					idx := p.index
+					p.mu.Unlock()
+					p.events.publish(EventTrack, trackEvent{Index: idx, Track: cb.Info})
+				}
+				state := StatePlay
+				if cb.Action == model.ActionPause {
+					state = StatePause
+				}
+				p.events.publish(EventState, stateEvent{state})
+			case model.ActionStop:
+				trackID = ""
+				p.events.publish(EventState, stateEvent{StateStop})
+			case model.ActionLyric:
+				p.events.publish(EventLyric, cb.Lyric)
+			}
+		case <-ticker.C:
+			if !p.pm.IsPlaying() {
+				continue
+			}
+			st := p.Status()
+			p.events.publish(EventPosition, positionEvent{st.Position, st.Duration})
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package daemon
+
+import "testing"
+
+// 缓冲已满时丢弃进度事件，其他事件关闭订阅
+func TestHubSlowSubscriber(t *testing.T) {
+	h := newHub()
+	ch := h.subscribe(1)
+
+	h.publish(EventQueue, nil)
+	h.publish(EventPosition, positionEvent{Position: 1})
+	h.publish(EventDownload, nil)
+	if ev := <-ch; ev.Type != EventQueue {
+		t.Fatalf("got %s, want queue", ev.Type)
+	}
+
+	h.publish(EventTrack, nil)
+	h.publish(EventQueue, nil)
+	if ev, ok := <-ch; !ok || ev.Type != EventTrack {
+		t.Fatalf("got %s %v, want track", ev.Type, ok)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("subscriber not closed after dropping queue event")
+	}
+	if len(h.subs) != 0 {
+		t.Errorf("%d subscribers left", len(h.subs))
+	}
+	// 已关闭的订阅可以再次取消
+	h.unsubscribe(ch)
+}
@@ -0,0 +1,370 @@
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"wander/model"
+)
+
+// MPD协议（0.23的子集），让mpc、ncmpcpp等客户端可以控制播放
+const mpdVersion = "0.23.0"
+
+// ACK错误码
+const (
+	ackArg        = 2
+	ackPassword   = 3
+	ackPermission = 4
+	ackUnknown    = 5
+	ackNoExist    = 50
+	ackSystem     = 52
+)
+
+type mpdError struct {
+	code int
+	msg  string
+}
+
+func (e *mpdError) Error() string { return e.msg }
+
+func mpdErr(code int, format string, args ...interface{}) error {
+	return &mpdError{code, fmt.Sprintf(format, args...)}
+}
+
+type MPDServer struct {
+	player  *Player
+	token   string
+	started time.Time
+}
+
+func NewMPDServer(player *Player, token string) *MPDServer {
+	return &MPDServer{player: player, token: token, started: time.Now()}
+}
+
+func (s *MPDServer) ListenAndServe(addr string) error {
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	log.Debug("mpd listen on", addr)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *MPDServer) songID(m *model.Music) int {
+	return s.player.TrackID(m)
+}
+
+// 按ID查找歌曲及其在队列中的位置，队列可能同时被其他连接修改，不要再按位置取歌曲
+func (s *MPDServer) findID(id int) (int, *model.Music, error) {
+	pos, m, err := s.player.FindTrack(id)
+	if err != nil {
+		return -1, nil, mpdErr(ackNoExist, "No such song")
+	}
+	return pos, m, nil
+}
+
+// 单个客户端连接
+type mpdConn struct {
+	s          *MPDServer
+	conn       net.Conn
+	w          *bufio.Writer
+	lines      chan string
+	authorized bool
+
+	done chan struct{} // 连接关闭时关闭
+
+	mu      sync.Mutex
+	pending map[string]bool // 上次idle之后发生变化的子系统
+	changed chan struct{}
+	version int // 队列版本，每次变化加一
+}
+
+func (s *MPDServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &mpdConn{
+		s:          s,
+		conn:       conn,
+		w:          bufio.NewWriter(conn),
+		lines:      make(chan string),
+		authorized: s.token == "",
+		done:       make(chan struct{}),
+		pending:    map[string]bool{},
+		changed:    make(chan struct{}, 1),
+		version:    1,
+	}
+	defer close(c.done)
+	events, snapshot := s.player.Subscribe(eventBuffer)
+	go c.collect(events, snapshot.Data.(Snapshot).Status)
+	go func() {
+		defer close(c.lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			// 连接已关闭时不再等待读取
+			select {
+			case c.lines <- scanner.Text():
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(c.w, "OK MPD %s\n", mpdVersion)
+	c.w.Flush()
+	for line := range c.lines {
+		if !c.handle(line) {
+			return
+		}
+		if c.w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// 记录发生变化的子系统，供idle使用
+func (c *mpdConn) collect(events <-chan Event, last Status) {
+	for {
+		var ev Event
+		select {
+		case <-c.done:
+			c.s.player.Unsubscribe(events)
+			return
+		case e, ok := <-events:
+			if !ok {
+				// 处理不及时被关闭，重新订阅，可能遗漏了变化，通知全部子系统
+				var snapshot Event
+				events, snapshot = c.s.player.Subscribe(eventBuffer)
+				last = snapshot.Data.(Snapshot).Status
+				c.notify("player", "playlist", "mixer", "options")
+				continue
+			}
+			ev = e
+		}
+		var subsystems []string
+		switch ev.Type {
+		case EventTrack, EventState:
+			subsystems = append(subsystems, "player")
+		case EventQueue:
+			subsystems = append(subsystems, "playlist")
+		case EventStatus:
+			st := ev.Data.(Status)
+			if st.Volume != last.Volume {
+				subsystems = append(subsystems, "mixer")
+			}
+			if st.Mode != last.Mode {
+				subsystems = append(subsystems, "options")
+			}
+			last = st
+		}
+		c.notify(subsystems...)
+	}
+}
+
+func (c *mpdConn) notify(subsystems ...string) {
+	if len(subsystems) == 0 {
+		return
+	}
+	c.mu.Lock()
+	for _, sub := range subsystems {
+		c.pending[sub] = true
+		if sub == "playlist" {
+			c.version++
+		}
+	}
+	c.mu.Unlock()
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *mpdConn) playlistVersion() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// 处理一行请求，返回false时关闭连接
+func (c *mpdConn) handle(line string) bool {
+	args, err := parseMPDArgs(line)
+	if err != nil {
+		c.ack(err, 0, "")
+		return true
+	}
+	if len(args) == 0 {
+		c.ack(mpdErr(ackUnknown, "No command given"), 0, "")
+		return true
+	}
+
+	switch args[0] {
+	case "close":
+		return false
+	case "idle":
+		return c.idle(args[1:])
+	case "noidle":
+		// 不在idle状态时忽略
+		return true
+	case "command_list_begin", "command_list_ok_begin":
+		return c.commandList(args[0] == "command_list_ok_begin")
+	}
+	if err = c.exec(args); err != nil {
+		c.ack(err, 0, args[0])
+	} else {
+		fmt.Fprint(c.w, "OK\n")
+	}
+	return true
+}
+
+// 批量执行命令，出错时停止执行后面的命令
+func (c *mpdConn) commandList(listOK bool) bool {
+	var cmds [][]string
+	for line := range c.lines {
+		if line == "command_list_end" {
+			for i, args := range cmds {
+				if err := c.exec(args); err != nil {
+					c.ack(err, i, args[0])
+					return true
+				}
+				if listOK {
+					fmt.Fprint(c.w, "list_OK\n")
+				}
+			}
+			fmt.Fprint(c.w, "OK\n")
+			return true
+		}
+		args, err := parseMPDArgs(line)
+		if err != nil || len(args) == 0 {
+			c.ack(mpdErr(ackArg, "invalid command list"), len(cmds), "")
+			return true
+		}
+		cmds = append(cmds, args)
+	}
+	return false
+}
+
+func (c *mpdConn) exec(args []string) error {
+	name := args[0]
+	cmd, ok := mpdCommands[name]
+	if !ok {
+		return mpdErr(ackUnknown, "unknown command \"%s\"", name)
+	}
+	if !c.authorized && name != "password" && name != "ping" {
+		return mpdErr(ackPermission, "you don't have permission for \"%s\"", name)
+	}
+	return cmd(c, args[1:])
+}
+
+// 等待子系统变化，收到noidle或客户端断开时返回
+func (c *mpdConn) idle(subsystems []string) bool {
+	if !c.authorized {
+		c.ack(mpdErr(ackPermission, "you don't have permission for \"idle\""), 0, "idle")
+		return true
+	}
+	want := map[string]bool{}
+	for _, sub := range subsystems {
+		want[sub] = true
+	}
+	// 未指定时关注所有子系统
+	take := func() []string {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var res []string
+		for sub := range c.pending {
+			if len(want) == 0 || want[sub] {
+				res = append(res, sub)
+				delete(c.pending, sub)
+			}
+		}
+		return res
+	}
+
+	for {
+		if changed := take(); len(changed) > 0 {
+			for _, sub := range changed {
+				fmt.Fprintf(c.w, "changed: %s\n", sub)
+			}
+			fmt.Fprint(c.w, "OK\n")
+			return true
+		}
+		if c.w.Flush() != nil {
+			return false
+		}
+		select {
+		case <-c.changed:
+		case line, ok := <-c.lines:
+			if !ok {
+				return false
+			}
+			fmt.Fprint(c.w, "OK\n")
+			// idle期间只允许noidle，其他命令视为先取消idle
+			if strings.TrimSpace(line) != "noidle" {
+				return c.handle(line)
+			}
+			return true
+		}
+	}
+}
+
+func (c *mpdConn) ack(err error, idx int, cmd string) {
+	code, msg := ackSystem, err.Error()
+	var me *mpdError
+	if errors.As(err, &me) {
+		code = me.code
+	} else if errors.Is(err, model.ErrNotFound) || errors.Is(err, model.ErrIndexOutOfRange) || errors.Is(err, ErrQueueEmpty) {
+		code = ackNoExist
+	} else if errors.Is(err, model.ErrInvalidPlaylist) {
+		code = ackArg
+	}
+	fmt.Fprintf(c.w, "ACK [%d@%d] {%s} %s\n", code, idx, cmd, msg)
+}
+
+func (c *mpdConn) writeField(key string, value interface{}) {
+	fmt.Fprintf(c.w, "%s: %v\n", key, value)
+}
+
+// 解析请求参数，支持双引号及反斜杠转义
+func parseMPDArgs(line string) ([]string, error) {
+	var (
+		args []string
+		sb   strings.Builder
+	)
+	line = strings.TrimSpace(line)
+	for i := 0; i < len(line); {
+		switch {
+		case line[i] == ' ' || line[i] == '\t':
+			i++
+		case line[i] == '"':
+			sb.Reset()
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				sb.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, mpdErr(ackArg, "Missing closing '\"'")
+			}
+			i++
+			args = append(args, sb.String())
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' {
+				j++
+			}
+			args = append(args, line[i:j])
+			i = j
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,585 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wander/model"
+)
+
+// 网易云歌曲的URI，如163:29759733
+const songScheme = model.ProviderNetease + ":"
+
+type mpdHandler func(c *mpdConn, args []string) error
+
+var mpdCommands map[string]mpdHandler
+
+func init() {
+	mpdCommands = map[string]mpdHandler{
+		"ping":               func(c *mpdConn, args []string) error { return nil },
+		"password":           mpdPassword,
+		"commands":           mpdListCommands,
+		"notcommands":        func(c *mpdConn, args []string) error { return nil },
+		"tagtypes":           mpdTagTypes,
+		"urlhandlers":        func(c *mpdConn, args []string) error { c.writeField("handler", songScheme); return nil },
+		"outputs":            mpdOutputs,
+		"replay_gain_status": func(c *mpdConn, args []string) error { c.writeField("replay_gain_mode", "off"); return nil },
+		"stats":              mpdStats,
+		"status":             mpdStatus,
+		"currentsong":        mpdCurrentSong,
+		"play":               mpdPlay,
+		"playid":             mpdPlayID,
+		"pause":              mpdPause,
+		"stop":               func(c *mpdConn, args []string) error { c.s.player.Stop(); return nil },
+		"next":               func(c *mpdConn, args []string) error { return c.s.player.Next() },
+		"previous":           func(c *mpdConn, args []string) error { return c.s.player.Prev() },
+		"seekcur":            mpdSeekCur,
+		"setvol":             mpdSetVol,
+		"getvol":             func(c *mpdConn, args []string) error { c.writeField("volume", c.s.player.Status().Volume); return nil },
+		"random":             mpdRandom,
+		"single":             mpdSingle,
+		"repeat":             mpdIgnoreOption,
+		"consume":            mpdIgnoreOption,
+		"playlistinfo":       mpdPlaylistInfo,
+		"playlistid":         mpdPlaylistID,
+		"plchanges":          mpdPlChanges,
+		"plchangesposid":     mpdPlChangesPosID,
+		"add":                mpdAdd,
+		"addid":              mpdAddID,
+		"delete":             mpdDelete,
+		"deleteid":           mpdDeleteID,
+		"move":               mpdMove,
+		"clear":              func(c *mpdConn, args []string) error { c.s.player.Clear(); return nil },
+		"search":             mpdSearch,
+		"find":               mpdSearch,
+		"list":               func(c *mpdConn, args []string) error { return nil },
+		"lsinfo":             mpdLsInfo,
+		"listplaylists":      mpdListPlaylists,
+		"listplaylist":       mpdListPlaylist,
+		"listplaylistinfo":   mpdListPlaylistInfo,
+		"load":               mpdLoad,
+	}
+}
+
+func mpdPassword(c *mpdConn, args []string) error {
+	if len(args) != 1 || subtle.ConstantTimeCompare([]byte(args[0]), []byte(c.s.token)) != 1 {
+		return mpdErr(ackPassword, "incorrect password")
+	}
+	c.authorized = true
+	return nil
+}
+
+func mpdListCommands(c *mpdConn, args []string) error {
+	names := []string{"close", "idle", "noidle", "command_list_begin", "command_list_ok_begin", "command_list_end"}
+	for name := range mpdCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.writeField("command", name)
+	}
+	return nil
+}
+
+func mpdTagTypes(c *mpdConn, args []string) error {
+	// tagtypes clear/all/enable/disable 不支持调整，直接忽略
+	if len(args) > 0 {
+		return nil
+	}
+	for _, tag := range []string{"Artist", "Album", "Title", "Track", "Disc", "Date"} {
+		c.writeField("tagtype", tag)
+	}
+	return nil
+}
+
+func mpdOutputs(c *mpdConn, args []string) error {
+	c.writeField("outputid", 0)
+	c.writeField("outputname", "wander")
+	c.writeField("plugin", "beep")
+	c.writeField("outputenabled", 1)
+	return nil
+}
+
+func mpdStats(c *mpdConn, args []string) error {
+	c.writeField("artists", 0)
+	c.writeField("albums", 0)
+	c.writeField("songs", 0)
+	c.writeField("uptime", int(time.Since(c.s.started).Seconds()))
+	c.writeField("playtime", 0)
+	c.writeField("db_playtime", 0)
+	return nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func mpdStatus(c *mpdConn, args []string) error {
+	st := c.s.player.Status()
+	tracks := c.s.player.Tracks()
+	c.writeField("volume", st.Volume)
+	// 顺序播放到末尾会回到开头，相当于repeat
+	c.writeField("repeat", 1)
+	c.writeField("random", boolInt(st.Mode == model.PlayModeShuffle))
+	c.writeField("single", boolInt(st.Mode == model.PlayModeRepeatOne))
+	c.writeField("consume", 0)
+	c.writeField("playlist", c.playlistVersion())
+	c.writeField("playlistlength", len(tracks))
+	c.writeField("state", st.State)
+	if st.State != StateStop && st.Index >= 0 && st.Index < len(tracks) {
+		c.writeField("song", st.Index)
+		c.writeField("songid", c.s.songID(tracks[st.Index]))
+		elapsed, duration := float64(st.Position)/1000, float64(st.Duration)/1000
+		c.writeField("time", fmt.Sprintf("%d:%d", int(elapsed), int(duration)))
+		c.writeField("elapsed", fmt.Sprintf("%.3f", elapsed))
+		c.writeField("duration", fmt.Sprintf("%.3f", duration))
+	}
+	return nil
+}
+
+func songURI(info model.MusicInfo) string {
+	if info.ID == "" {
+		return info.MusicLocal
+	}
+	return songScheme + info.ID
+}
+
+// pos<0时不输出队列位置
+func (c *mpdConn) writeSong(info model.MusicInfo, pos, id int) {
+	c.writeField("file", songURI(info))
+	c.writeField("Title", info.Name)
+	if info.ArtistsName != "" {
+		c.writeField("Artist", info.ArtistsName)
+	}
+	if info.AlbumName != "" {
+		c.writeField("Album", info.AlbumName)
+	}
+	if info.TrackNo > 0 {
+		c.writeField("Track", info.TrackNo)
+	}
+	if info.DiscNo > 0 {
+		c.writeField("Disc", info.DiscNo)
+	}
+	if !info.PublishTime.IsZero() {
+		c.writeField("Date", info.PublishTime.Format("2006-01-02"))
+	}
+	if info.Duration > 0 {
+		c.writeField("Time", int(info.Duration.Seconds()))
+		c.writeField("duration", fmt.Sprintf("%.3f", info.Duration.Seconds()))
+	}
+	if pos >= 0 {
+		c.writeField("Pos", pos)
+		c.writeField("Id", id)
+	}
+}
+
+func mpdCurrentSong(c *mpdConn, args []string) error {
+	st := c.s.player.Status()
+	tracks := c.s.player.Tracks()
+	if st.State == StateStop || st.Index < 0 || st.Index >= len(tracks) {
+		return nil
+	}
+	c.writeSong(tracks[st.Index].Info, st.Index, c.s.songID(tracks[st.Index]))
+	return nil
+}
+
+func parseInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, mpdErr(ackArg, "Integer expected: %s", s)
+	}
+	return n, nil
+}
+
+// 解析 pos 或 start:end，end为空时到队列末尾
+func parseRange(s string, n int) (int, int, error) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		start, err := parseInt(s[:i])
+		if err != nil {
+			return 0, 0, err
+		}
+		end := n
+		if s[i+1:] != "" {
+			if end, err = parseInt(s[i+1:]); err != nil {
+				return 0, 0, err
+			}
+		}
+		if start < 0 || start > end || end > n {
+			return 0, 0, mpdErr(ackArg, "Bad song index")
+		}
+		return start, end, nil
+	}
+	pos, err := parseInt(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if pos < 0 || pos >= n {
+		return 0, 0, mpdErr(ackArg, "Bad song index")
+	}
+	return pos, pos + 1, nil
+}
+
+func mpdPlay(c *mpdConn, args []string) error {
+	if len(args) == 0 {
+		return c.s.player.Resume()
+	}
+	pos, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	return c.s.player.Play(pos)
+}
+
+func mpdPlayID(c *mpdConn, args []string) error {
+	if len(args) == 0 {
+		return c.s.player.Resume()
+	}
+	id, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	pos, _, err := c.s.findID(id)
+	if err != nil {
+		return err
+	}
+	return c.s.player.Play(pos)
+}
+
+// pause [0|1]，不带参数时切换
+func mpdPause(c *mpdConn, args []string) error {
+	if len(args) == 0 {
+		return c.s.player.Toggle()
+	}
+	if args[0] == "1" {
+		c.s.player.Pause()
+		return nil
+	}
+	return c.s.player.Resume()
+}
+
+// seekcur {TIME}，带+/-时为相对当前位置
+func mpdSeekCur(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"seekcur\"")
+	}
+	secs, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return mpdErr(ackArg, "Float expected: %s", args[0])
+	}
+	d := time.Duration(secs * float64(time.Second))
+	if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+		c.s.player.SeekBy(d)
+	} else {
+		c.s.player.Seek(d)
+	}
+	return nil
+}
+
+func mpdSetVol(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"setvol\"")
+	}
+	volume, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	if volume < 0 || volume > model.MaxVolume {
+		return mpdErr(ackArg, "Invalid volume value")
+	}
+	c.s.player.SetVolume(volume)
+	return nil
+}
+
+func mpdRandom(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"random\"")
+	}
+	if args[0] == "1" {
+		return c.s.player.SetMode(model.PlayModeShuffle)
+	}
+	if c.s.player.Status().Mode == model.PlayModeShuffle {
+		return c.s.player.SetMode(model.PlayModeOrder)
+	}
+	return nil
+}
+
+func mpdSingle(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"single\"")
+	}
+	if args[0] == "1" {
+		return c.s.player.SetMode(model.PlayModeRepeatOne)
+	}
+	if c.s.player.Status().Mode == model.PlayModeRepeatOne {
+		return c.s.player.SetMode(model.PlayModeOrder)
+	}
+	return nil
+}
+
+// repeat、consume没有对应的播放模式
+func mpdIgnoreOption(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments")
+	}
+	return nil
+}
+
+// playlistinfo [pos|start:end]
+func mpdPlaylistInfo(c *mpdConn, args []string) error {
+	tracks := c.s.player.Tracks()
+	start, end := 0, len(tracks)
+	if len(args) > 0 {
+		var err error
+		if start, end, err = parseRange(args[0], len(tracks)); err != nil {
+			return err
+		}
+	}
+	for i := start; i < end; i++ {
+		c.writeSong(tracks[i].Info, i, c.s.songID(tracks[i]))
+	}
+	return nil
+}
+
+// plchanges {VERSION}，不记录每个版本的变化，直接返回整个队列
+func mpdPlChanges(c *mpdConn, args []string) error {
+	return mpdPlaylistInfo(c, nil)
+}
+
+func mpdPlaylistID(c *mpdConn, args []string) error {
+	if len(args) == 0 {
+		return mpdPlaylistInfo(c, nil)
+	}
+	id, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	pos, m, err := c.s.findID(id)
+	if err != nil {
+		return err
+	}
+	c.writeSong(m.Info, pos, id)
+	return nil
+}
+
+func mpdPlChangesPosID(c *mpdConn, args []string) error {
+	for i, m := range c.s.player.Tracks() {
+		c.writeField("cpos", i)
+		c.writeField("Id", c.s.songID(m))
+	}
+	return nil
+}
+
+// 解析歌曲URI：163:<id>或纯数字ID
+func parseSongURI(uri string) (string, bool) {
+	uri = strings.TrimPrefix(uri, songScheme)
+	if _, err := strconv.ParseUint(uri, 10, 64); err == nil {
+		return uri, true
+	}
+	return "", false
+}
+
+// add {URI} [POSITION]，addid返回新歌曲的ID
+func mpdAdd(c *mpdConn, args []string) error {
+	_, err := addSong(c, "add", args)
+	return err
+}
+
+// 与add相同，返回新歌曲的ID
+func mpdAddID(c *mpdConn, args []string) error {
+	music, err := addSong(c, "addid", args)
+	if err != nil {
+		return err
+	}
+	c.writeField("Id", c.s.songID(music))
+	return nil
+}
+
+func addSong(c *mpdConn, name string, args []string) (*model.Music, error) {
+	if len(args) == 0 {
+		return nil, mpdErr(ackArg, "wrong number of arguments for \"%s\"", name)
+	}
+	id, ok := parseSongURI(args[0])
+	if !ok {
+		return nil, mpdErr(ackNoExist, "No such song: %s", args[0])
+	}
+	pos := -1
+	if len(args) > 1 {
+		var err error
+		if pos, err = parseInt(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	music, err := model.RequestSong(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.s.player.Add(pos, music); err != nil {
+		return nil, err
+	}
+	return music, nil
+}
+
+func mpdDelete(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"delete\"")
+	}
+	start, end, err := parseRange(args[0], len(c.s.player.Tracks()))
+	if err != nil {
+		return err
+	}
+	for i := end - 1; i >= start; i-- {
+		if err = c.s.player.Remove(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mpdDeleteID(c *mpdConn, args []string) error {
+	if len(args) != 1 {
+		return mpdErr(ackArg, "wrong number of arguments for \"deleteid\"")
+	}
+	id, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	pos, _, err := c.s.findID(id)
+	if err != nil {
+		return err
+	}
+	return c.s.player.Remove(pos)
+}
+
+func mpdMove(c *mpdConn, args []string) error {
+	if len(args) != 2 {
+		return mpdErr(ackArg, "wrong number of arguments for \"move\"")
+	}
+	from, err := parseInt(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := parseInt(args[1])
+	if err != nil {
+		return err
+	}
+	return c.s.player.Move(from, to)
+}
+
+// search {TYPE} {WHAT} [...] 或过滤表达式，统一按关键字在线搜索歌曲
+func mpdSearch(c *mpdConn, args []string) error {
+	var keywords []string
+	if len(args) == 1 {
+		// (any contains 'xxx')
+		expr := strings.Trim(args[0], "()")
+		if i := strings.IndexAny(expr, "'\""); i >= 0 {
+			keywords = append(keywords, strings.Trim(expr[i:], "'\""))
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		if args[i-1] == "window" || args[i-1] == "sort" {
+			continue
+		}
+		keywords = append(keywords, args[i])
+	}
+	if len(keywords) == 0 {
+		return mpdErr(ackArg, "incorrect arguments")
+	}
+	musics, _, err := model.SearchMusic(strings.Join(keywords, " "), 0, model.DefaultSearchLimit)
+	if err != nil {
+		return err
+	}
+	for _, m := range musics {
+		c.writeSong(m.Info, -1, 0)
+	}
+	return nil
+}
+
+// 只有根目录，列出歌单
+func mpdLsInfo(c *mpdConn, args []string) error {
+	if len(args) > 0 && args[0] != "" && args[0] != "/" {
+		return mpdErr(ackNoExist, "No such directory")
+	}
+	return mpdListPlaylists(c, nil)
+}
+
+// 歌单及榜单作为MPD的stored playlist，以名称区分
+func mpdListPlaylists(c *mpdConn, args []string) error {
+	for _, p := range c.s.player.Store().List() {
+		c.writeField("playlist", p.Name)
+		updated := p.Updated
+		if updated.IsZero() {
+			updated = c.s.started
+		}
+		c.writeField("Last-Modified", updated.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// 按名称或ID查找歌单
+func (c *mpdConn) findPlaylist(name string) (string, error) {
+	for _, p := range c.s.player.Store().List() {
+		if p.Name == name || p.ID == name {
+			return p.ID, nil
+		}
+	}
+	return "", mpdErr(ackNoExist, "No such playlist")
+}
+
+func (c *mpdConn) loadPlaylist(args []string) ([]*model.Music, string, error) {
+	if len(args) == 0 {
+		return nil, "", mpdErr(ackArg, "wrong number of arguments")
+	}
+	id, err := c.findPlaylist(args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	_, musics, err := c.s.player.Store().Load(id)
+	return musics, id, err
+}
+
+func mpdListPlaylist(c *mpdConn, args []string) error {
+	musics, _, err := c.loadPlaylist(args)
+	if err != nil {
+		return err
+	}
+	for _, m := range musics {
+		c.writeField("file", songURI(m.Info))
+	}
+	return nil
+}
+
+func mpdListPlaylistInfo(c *mpdConn, args []string) error {
+	musics, _, err := c.loadPlaylist(args)
+	if err != nil {
+		return err
+	}
+	for _, m := range musics {
+		c.writeSong(m.Info, -1, 0)
+	}
+	return nil
+}
+
+// load {NAME} [START:END]
+func mpdLoad(c *mpdConn, args []string) error {
+	musics, id, err := c.loadPlaylist(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		start, end, err := parseRange(args[1], len(musics))
+		if err != nil {
+			return err
+		}
+		musics = musics[start:end]
+	}
+	for _, m := range musics {
+		m.Source = id
+	}
+	return c.s.player.Add(-1, musics...)
+}
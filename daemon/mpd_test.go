@@ -0,0 +1,203 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mpdClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// 通过net.Pipe连接到MPD服务，返回时已读取握手
+func newMPDClient(t *testing.T, s *MPDServer) *mpdClient {
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.serve(server)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("mpd connection not closed")
+		}
+	})
+	c := &mpdClient{t: t, conn: client, r: bufio.NewReader(client)}
+	if got := c.readLine(); got != "OK MPD "+mpdVersion {
+		t.Fatalf("handshake = %q", got)
+	}
+	return c
+}
+
+func (c *mpdClient) readLine() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func (c *mpdClient) send(lines ...string) {
+	c.t.Helper()
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(c.conn, line); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// 读取响应直到OK或ACK，返回之前的行及最后一行
+func (c *mpdClient) response() ([]string, string) {
+	c.t.Helper()
+	var lines []string
+	for {
+		line := c.readLine()
+		if line == "OK" || strings.HasPrefix(line, "ACK ") {
+			return lines, line
+		}
+		lines = append(lines, line)
+	}
+}
+
+// 执行命令并要求成功，返回字段
+func (c *mpdClient) command(line string) map[string]string {
+	c.t.Helper()
+	c.send(line)
+	lines, end := c.response()
+	if end != "OK" {
+		c.t.Fatalf("%s: %s", line, end)
+	}
+	fields := map[string]string{}
+	for _, l := range lines {
+		if i := strings.Index(l, ": "); i > 0 {
+			fields[l[:i]] = l[i+2:]
+		}
+	}
+	return fields
+}
+
+func TestMPDStatus(t *testing.T) {
+	player := newTestPlayer(t)
+	if err := player.Add(-1, silentMusic(t, "晴天")); err != nil {
+		t.Fatal(err)
+	}
+	c := newMPDClient(t, NewMPDServer(player, ""))
+
+	st := c.command("status")
+	if st["state"] != "stop" || st["playlistlength"] != "1" || st["song"] != "" {
+		t.Errorf("status before play = %v", st)
+	}
+	if song := c.command("currentsong"); len(song) != 0 {
+		t.Errorf("currentsong before play = %v", song)
+	}
+
+	c.command("play 0")
+	st = c.command("status")
+	if st["state"] != "play" || st["song"] != "0" || st["songid"] == "" {
+		t.Errorf("status after play = %v", st)
+	}
+	song := c.command("currentsong")
+	if song["Title"] != "晴天" || song["Artist"] != "wander" || song["Pos"] != "0" || song["Id"] != st["songid"] {
+		t.Errorf("currentsong = %v", song)
+	}
+	if song = c.command("playlistid " + st["songid"]); song["Title"] != "晴天" || song["Pos"] != "0" {
+		t.Errorf("playlistid = %v", song)
+	}
+
+	// 队列被其他客户端清空后按ID查找
+	player.Clear()
+	c.send("playlistid " + st["songid"])
+	if _, end := c.response(); end != "ACK [50@0] {playlistid} No such song" {
+		t.Errorf("playlistid after clear = %s", end)
+	}
+}
+
+func TestMPDCommandList(t *testing.T) {
+	c := newMPDClient(t, NewMPDServer(newTestPlayer(t), ""))
+
+	c.send("command_list_ok_begin", "ping", "status", "command_list_end")
+	lines, end := c.response()
+	if end != "OK" || len(lines) < 2 || lines[0] != "list_OK" || lines[len(lines)-1] != "list_OK" {
+		t.Errorf("command_list_ok_begin = %q, %s", lines, end)
+	}
+
+	// 出错时停止执行，ACK中为出错命令的序号
+	c.send("command_list_begin", "ping", "setvol 50", "nosuch", "setvol 10", "command_list_end")
+	lines, end = c.response()
+	if want := `ACK [5@2] {nosuch} unknown command "nosuch"`; end != want || len(lines) != 0 {
+		t.Errorf("command_list_begin = %q, %q, want %q", lines, end, want)
+	}
+	if st := c.command("status"); st["volume"] != "50" {
+		t.Errorf("volume = %s, want 50", st["volume"])
+	}
+}
+
+func TestMPDAck(t *testing.T) {
+	c := newMPDClient(t, NewMPDServer(newTestPlayer(t), "secret"))
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"status", `ACK [4@0] {status} you don't have permission for "status"`},
+		{"password wrong", `ACK [3@0] {password} incorrect password`},
+		{"password secret", "OK"},
+		{"nosuch", `ACK [5@0] {nosuch} unknown command "nosuch"`},
+		{`add "163:1`, `ACK [2@0] {} Missing closing '"'`},
+		{"add", `ACK [2@0] {add} wrong number of arguments for "add"`},
+		{"addid", `ACK [2@0] {addid} wrong number of arguments for "addid"`},
+		{"playid 99", `ACK [50@0] {playid} No such song`},
+		{"setvol x", `ACK [2@0] {setvol} Integer expected: x`},
+	}
+	for _, tt := range tests {
+		c.send(tt.line)
+		if lines, end := c.response(); end != tt.want || len(lines) != 0 {
+			t.Errorf("%s = %q, %q, want %q", tt.line, lines, end, tt.want)
+		}
+	}
+}
+
+func TestMPDIdle(t *testing.T) {
+	player := newTestPlayer(t)
+	c := newMPDClient(t, NewMPDServer(player, ""))
+
+	// 没有变化时noidle直接返回OK
+	c.send("idle mixer", "noidle")
+	if lines, end := c.response(); end != "OK" || len(lines) != 0 {
+		t.Errorf("noidle = %q, %s", lines, end)
+	}
+
+	c.send("idle mixer options")
+	time.Sleep(50 * time.Millisecond)
+	player.SetVolume(30)
+	if lines, end := c.response(); end != "OK" || len(lines) != 1 || lines[0] != "changed: mixer" {
+		t.Errorf("idle = %q, %s", lines, end)
+	}
+	if st := c.command("status"); st["volume"] != "30" {
+		t.Errorf("volume = %s, want 30", st["volume"])
+	}
+
+	// 已有的变化在下次idle时立即返回
+	player.SetVolume(40)
+	time.Sleep(50 * time.Millisecond)
+	c.send("idle")
+	if lines, end := c.response(); end != "OK" || len(lines) != 1 || lines[0] != "changed: mixer" {
+		t.Errorf("pending idle = %q, %s", lines, end)
+	}
+
+	c.send("close")
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if line, err := c.r.ReadString('\n'); err == nil {
+		t.Errorf("read %q after close", line)
+	}
+}
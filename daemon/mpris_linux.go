@@ -0,0 +1,508 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/lauthrul/goutil/log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wander/model"
+)
+
+// MPRIS2，让桌面环境的媒体键、播放器小部件控制播放
+const (
+	mprisName      = "org.mpris.MediaPlayer2.wander"
+	mprisPath      = "/org/mpris/MediaPlayer2"
+	mprisRoot      = "org.mpris.MediaPlayer2"
+	mprisPlayer    = "org.mpris.MediaPlayer2.Player"
+	mprisTrackList = "org.mpris.MediaPlayer2.TrackList"
+	mprisTrackPath = "/org/wander/track/"
+)
+
+var mprisNoTrack = dbus.ObjectPath("/org/mpris/MediaPlayer2/TrackList/NoTrack")
+
+// Seek与io.Seeker签名不同，Go方法改名后再映射回D-Bus方法名
+var mprisControlNames = map[string]string{"SeekBy": "Seek"}
+
+type mpris struct {
+	player *Player
+	conn   *dbus.Conn
+	props  *mprisProps
+	quit   func()
+
+	mu          sync.Mutex
+	lastPos     int64 // 上次更新的进度，微秒，用于发现其他客户端的跳转
+	lastAt      time.Time
+	lastPlaying bool
+}
+
+// 在会话总线上注册MPRIS，客户端调用Quit时执行quit
+func StartMPRIS(player *Player, quit func()) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	m := &mpris{player: player, conn: conn, quit: quit}
+	events, snapshot := player.Subscribe(eventBuffer)
+	if err = m.export(snapshot.Data.(Snapshot)); err != nil {
+		player.Unsubscribe(events)
+		conn.Close()
+		return err
+	}
+	if err = m.requestName(); err != nil {
+		player.Unsubscribe(events)
+		conn.Close()
+		return err
+	}
+	go m.loop(events)
+	return nil
+}
+
+// 名称已被占用时按规范加上.instance<pid>后缀
+func (m *mpris) requestName() error {
+	for _, name := range []string{mprisName, fmt.Sprintf("%s.instance%d", mprisName, os.Getpid())} {
+		reply, err := m.conn.RequestName(name, dbus.NameFlagDoNotQueue)
+		if err != nil {
+			return err
+		}
+		if reply == dbus.RequestNameReplyPrimaryOwner {
+			log.Debug("mpris register", name)
+			return nil
+		}
+	}
+	return fmt.Errorf("mpris: name %s already taken", mprisName)
+}
+
+func (m *mpris) export(snapshot Snapshot) error {
+	app, control, tracks := mprisApp{m}, mprisControl{m}, mprisTracks{m}
+	if err := m.conn.Export(app, mprisPath, mprisRoot); err != nil {
+		return err
+	}
+	if err := m.conn.ExportWithMap(control, mprisControlNames, mprisPath, mprisPlayer); err != nil {
+		return err
+	}
+	if err := m.conn.Export(tracks, mprisPath, mprisTrackList); err != nil {
+		return err
+	}
+
+	st := snapshot.Status
+	props := newMPRISProps(m.conn, mprisPath)
+	props.add(mprisRoot, "CanQuit", true, emitConst, nil)
+	props.add(mprisRoot, "CanRaise", false, emitConst, nil)
+	props.add(mprisRoot, "HasTrackList", true, emitConst, nil)
+	props.add(mprisRoot, "Identity", "wander", emitConst, nil)
+	props.add(mprisRoot, "SupportedUriSchemes", []string{model.ProviderNetease}, emitConst, nil)
+	props.add(mprisRoot, "SupportedMimeTypes", []string{"audio/mpeg"}, emitConst, nil)
+	props.add(mprisPlayer, "PlaybackStatus", playbackStatus(st.State), emitTrue, nil)
+	props.add(mprisPlayer, "LoopStatus", loopStatus(st.Mode), emitTrue, m.onLoopStatus)
+	props.add(mprisPlayer, "Shuffle", st.Mode == model.PlayModeShuffle, emitTrue, m.onShuffle)
+	props.add(mprisPlayer, "Rate", 1.0, emitTrue, func(dbus.Variant) *dbus.Error { return nil })
+	props.add(mprisPlayer, "MinimumRate", 1.0, emitConst, nil)
+	props.add(mprisPlayer, "MaximumRate", 1.0, emitConst, nil)
+	props.add(mprisPlayer, "Metadata", m.metadata(m.current(st)), emitTrue, nil)
+	props.add(mprisPlayer, "Volume", float64(st.Volume)/100, emitTrue, m.onVolume)
+	props.add(mprisPlayer, "Position", st.Position*1000, emitFalse, nil)
+	props.add(mprisPlayer, "CanGoNext", st.Queue > 0, emitTrue, nil)
+	props.add(mprisPlayer, "CanGoPrevious", st.Queue > 0, emitTrue, nil)
+	props.add(mprisPlayer, "CanPlay", st.Queue > 0 || st.Track != nil, emitTrue, nil)
+	props.add(mprisPlayer, "CanPause", st.Track != nil, emitTrue, nil)
+	props.add(mprisPlayer, "CanSeek", st.Track != nil, emitTrue, nil)
+	props.add(mprisPlayer, "CanControl", true, emitConst, nil)
+	props.add(mprisTrackList, "Tracks", m.trackIDs(), emitInvalidates, nil)
+	props.add(mprisTrackList, "CanEditTracks", true, emitConst, nil)
+	if err := m.conn.Export(props, mprisPath, "org.freedesktop.DBus.Properties"); err != nil {
+		return err
+	}
+	m.props = props
+	m.lastPos, m.lastAt, m.lastPlaying = st.Position*1000, time.Now(), st.State == StatePlay
+
+	node := &introspect.Node{
+		Name: mprisPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: mprisRoot, Methods: introspect.Methods(app), Properties: props.introspection(mprisRoot)},
+			{
+				Name:       mprisPlayer,
+				Methods:    renameMethods(introspect.Methods(control), mprisControlNames),
+				Properties: props.introspection(mprisPlayer),
+				Signals:    []introspect.Signal{{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}}},
+			},
+			{
+				Name:       mprisTrackList,
+				Methods:    introspect.Methods(tracks),
+				Properties: props.introspection(mprisTrackList),
+				Signals: []introspect.Signal{{Name: "TrackListReplaced", Args: []introspect.Arg{
+					{Name: "Tracks", Type: "ao"}, {Name: "CurrentTrack", Type: "o"},
+				}}},
+			},
+		},
+	}
+	return m.conn.Export(introspect.NewIntrospectable(node), mprisPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// 将播放器事件同步到属性，属性变化时发出PropertiesChanged
+func (m *mpris) loop(events <-chan Event) {
+	for {
+		ev, ok := <-events
+		if !ok {
+			// 处理不及时被关闭，重新订阅后按当前状态刷新全部属性
+			events, _ = m.player.Subscribe(eventBuffer)
+			m.props.set(mprisTrackList, "Tracks", m.trackIDs())
+			m.emitTrackList()
+			m.update()
+			continue
+		}
+		switch ev.Type {
+		case EventPosition:
+			m.updatePosition(ev.Data.(positionEvent).Position*1000, true)
+		case EventQueue:
+			m.props.set(mprisTrackList, "Tracks", m.trackIDs())
+			m.emitTrackList()
+			m.update()
+		case EventTrack, EventState, EventStatus:
+			m.update()
+		}
+	}
+}
+
+func (m *mpris) update() {
+	st := m.player.Status()
+	metadata := m.metadata(m.current(st))
+	trackChanged := m.props.value(mprisPlayer, "Metadata").(map[string]dbus.Variant)["mpris:trackid"] != metadata["mpris:trackid"]
+	m.props.set(mprisPlayer, "PlaybackStatus", playbackStatus(st.State))
+	m.props.set(mprisPlayer, "LoopStatus", loopStatus(st.Mode))
+	m.props.set(mprisPlayer, "Shuffle", st.Mode == model.PlayModeShuffle)
+	m.props.set(mprisPlayer, "Metadata", metadata)
+	m.props.set(mprisPlayer, "Volume", float64(st.Volume)/100)
+	m.props.set(mprisPlayer, "CanGoNext", st.Queue > 0)
+	m.props.set(mprisPlayer, "CanGoPrevious", st.Queue > 0)
+	m.props.set(mprisPlayer, "CanPlay", st.Queue > 0 || st.Track != nil)
+	m.props.set(mprisPlayer, "CanPause", st.Track != nil)
+	m.props.set(mprisPlayer, "CanSeek", st.Track != nil)
+	// 切换歌曲时进度归零不算跳转
+	m.updatePosition(st.Position*1000, !trackChanged)
+}
+
+// 进度与按时间推算的不一致时，说明发生了跳转，detect为false时只更新进度
+func (m *mpris) updatePosition(pos int64, detect bool) {
+	m.mu.Lock()
+	expect := m.lastPos
+	if m.lastPlaying {
+		expect += time.Since(m.lastAt).Microseconds()
+	}
+	m.lastPos, m.lastAt = pos, time.Now()
+	m.lastPlaying = m.props.value(mprisPlayer, "PlaybackStatus") == "Playing"
+	m.mu.Unlock()
+
+	m.props.set(mprisPlayer, "Position", pos)
+	if diff := pos - expect; detect && (diff > time.Second.Microseconds() || diff < -time.Second.Microseconds()) {
+		m.emitSeeked(pos)
+	}
+}
+
+func (m *mpris) emitSeeked(pos int64) {
+	if err := m.conn.Emit(mprisPath, mprisPlayer+".Seeked", pos); err != nil {
+		log.Error("mpris emit seeked err:", err)
+	}
+}
+
+func (m *mpris) emitTrackList() {
+	current := mprisNoTrack
+	if music := m.current(m.player.Status()); music != nil {
+		current = m.trackPath(music)
+	}
+	if err := m.conn.Emit(mprisPath, mprisTrackList+".TrackListReplaced", m.trackIDs(), current); err != nil {
+		log.Error("mpris emit track list err:", err)
+	}
+}
+
+// 当前播放的队列歌曲
+func (m *mpris) current(st Status) *model.Music {
+	tracks := m.player.Tracks()
+	if st.Track == nil || st.Index < 0 || st.Index >= len(tracks) {
+		return nil
+	}
+	return tracks[st.Index]
+}
+
+func (m *mpris) trackPath(music *model.Music) dbus.ObjectPath {
+	return dbus.ObjectPath(mprisTrackPath + strconv.Itoa(m.player.TrackID(music)))
+}
+
+func (m *mpris) trackIDs() []dbus.ObjectPath {
+	ids := []dbus.ObjectPath{}
+	for _, music := range m.player.Tracks() {
+		ids = append(ids, m.trackPath(music))
+	}
+	return ids
+}
+
+// 按对象路径查找歌曲在队列中的位置
+func (m *mpris) findTrack(path dbus.ObjectPath) (int, *dbus.Error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(string(path), mprisTrackPath))
+	if err != nil || !strings.HasPrefix(string(path), mprisTrackPath) {
+		return -1, dbus.MakeFailedError(fmt.Errorf("invalid track id: %s", path))
+	}
+	idx, _, err := m.player.FindTrack(id)
+	if err != nil {
+		return -1, dbus.MakeFailedError(err)
+	}
+	return idx, nil
+}
+
+func (m *mpris) metadata(music *model.Music) map[string]dbus.Variant {
+	if music == nil {
+		return map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(mprisNoTrack)}
+	}
+	info := music.Info
+	md := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(m.trackPath(music)),
+		"xesam:title":   dbus.MakeVariant(info.Name),
+	}
+	if info.ArtistsName != "" {
+		md["xesam:artist"] = dbus.MakeVariant(strings.Split(info.ArtistsName, ","))
+	}
+	if info.AlbumName != "" {
+		md["xesam:album"] = dbus.MakeVariant(info.AlbumName)
+	}
+	if info.TrackNo > 0 {
+		md["xesam:trackNumber"] = dbus.MakeVariant(int32(info.TrackNo))
+	}
+	if info.Duration > 0 {
+		md["mpris:length"] = dbus.MakeVariant(info.Duration.Microseconds())
+	}
+	if info.MusicPicLocal != "" {
+		md["mpris:artUrl"] = dbus.MakeVariant(fileURL(info.MusicPicLocal))
+	}
+	if info.ID != "" {
+		md["xesam:url"] = dbus.MakeVariant(songScheme + info.ID)
+	} else if info.MusicLocal != "" {
+		md["xesam:url"] = dbus.MakeVariant(fileURL(info.MusicLocal))
+	}
+	return md
+}
+
+func renameMethods(methods []introspect.Method, names map[string]string) []introspect.Method {
+	for i := range methods {
+		if name, ok := names[methods[i].Name]; ok {
+			methods[i].Name = name
+		}
+	}
+	return methods
+}
+
+// 文件名中常有空格、#和中文，需要转义
+func fileURL(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func (m *mpris) onLoopStatus(v dbus.Variant) *dbus.Error {
+	mode := m.player.Status().Mode
+	switch v.Value().(string) {
+	case "Track":
+		mode = model.PlayModeRepeatOne
+	case "None", "Playlist":
+		if mode == model.PlayModeRepeatOne {
+			mode = model.PlayModeOrder
+		}
+	default:
+		return prop.ErrInvalidArg
+	}
+	return toDBusError(m.player.SetMode(mode))
+}
+
+// 关闭随机时保留单曲循环
+func (m *mpris) onShuffle(v dbus.Variant) *dbus.Error {
+	mode := m.player.Status().Mode
+	if v.Value().(bool) {
+		mode = model.PlayModeShuffle
+	} else if mode == model.PlayModeShuffle {
+		mode = model.PlayModeOrder
+	}
+	return toDBusError(m.player.SetMode(mode))
+}
+
+func (m *mpris) onVolume(v dbus.Variant) *dbus.Error {
+	volume := int(v.Value().(float64)*100 + 0.5)
+	if volume < 0 {
+		volume = 0
+	} else if volume > 100 {
+		volume = 100
+	}
+	m.player.SetVolume(volume)
+	return nil
+}
+
+func toDBusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	return dbus.MakeFailedError(err)
+}
+
+// 按URI加载歌曲，支持163:<id>
+func loadSongURI(uri string) (*model.Music, error) {
+	id, ok := parseSongURI(uri)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", model.ErrInvalidPlaylist, uri)
+	}
+	return model.RequestSong(id)
+}
+
+func playbackStatus(state string) string {
+	switch state {
+	case StatePlay:
+		return "Playing"
+	case StatePause:
+		return "Paused"
+	}
+	return "Stopped"
+}
+
+// 顺序播放时队列循环
+func loopStatus(mode model.PlayMode) string {
+	if mode == model.PlayModeRepeatOne {
+		return "Track"
+	}
+	return "Playlist"
+}
+
+// org.mpris.MediaPlayer2
+type mprisApp struct{ m *mpris }
+
+func (a mprisApp) Raise() *dbus.Error {
+	return nil
+}
+
+func (a mprisApp) Quit() *dbus.Error {
+	if a.m.quit != nil {
+		a.m.quit()
+	}
+	return nil
+}
+
+// org.mpris.MediaPlayer2.Player
+type mprisControl struct{ m *mpris }
+
+func (c mprisControl) Next() *dbus.Error {
+	return toDBusError(c.m.player.Next())
+}
+
+func (c mprisControl) Previous() *dbus.Error {
+	return toDBusError(c.m.player.Prev())
+}
+
+func (c mprisControl) Pause() *dbus.Error {
+	c.m.player.Pause()
+	return nil
+}
+
+func (c mprisControl) PlayPause() *dbus.Error {
+	return toDBusError(c.m.player.Toggle())
+}
+
+func (c mprisControl) Stop() *dbus.Error {
+	c.m.player.Stop()
+	return nil
+}
+
+func (c mprisControl) Play() *dbus.Error {
+	return toDBusError(c.m.player.Resume())
+}
+
+// offset单位为微秒
+func (c mprisControl) SeekBy(offset int64) *dbus.Error {
+	c.m.player.SeekBy(time.Duration(offset) * time.Microsecond)
+	c.m.updatePosition(c.m.player.Status().Position*1000, true)
+	return nil
+}
+
+// 不是当前歌曲或超出范围时按规范忽略
+func (c mprisControl) SetPosition(track dbus.ObjectPath, pos int64) *dbus.Error {
+	st := c.m.player.Status()
+	music := c.m.current(st)
+	if music == nil || c.m.trackPath(music) != track || pos < 0 || pos > st.Duration*1000 {
+		return nil
+	}
+	c.m.player.Seek(time.Duration(pos) * time.Microsecond)
+	c.m.updatePosition(c.m.player.Status().Position*1000, true)
+	return nil
+}
+
+// 追加到队列末尾并播放
+func (c mprisControl) OpenUri(uri string) *dbus.Error {
+	music, err := loadSongURI(uri)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return toDBusError(c.m.player.PlayNow(music))
+}
+
+// org.mpris.MediaPlayer2.TrackList
+type mprisTracks struct{ m *mpris }
+
+func (t mprisTracks) GetTracksMetadata(ids []dbus.ObjectPath) ([]map[string]dbus.Variant, *dbus.Error) {
+	tracks := t.m.player.Tracks()
+	res := []map[string]dbus.Variant{}
+	for _, id := range ids {
+		idx, err := t.m.findTrack(id)
+		if err != nil || idx >= len(tracks) {
+			continue
+		}
+		res = append(res, t.m.metadata(tracks[idx]))
+	}
+	return res, nil
+}
+
+// after为NoTrack时插入到队列开头
+func (t mprisTracks) AddTrack(uri string, after dbus.ObjectPath, setCurrent bool) *dbus.Error {
+	pos := 0
+	if after != mprisNoTrack {
+		idx, err := t.m.findTrack(after)
+		if err != nil {
+			return err
+		}
+		pos = idx + 1
+	}
+	music, err := loadSongURI(uri)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if err = t.m.player.Add(pos, music); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if setCurrent {
+		return toDBusError(t.m.player.Play(pos))
+	}
+	return nil
+}
+
+func (t mprisTracks) RemoveTrack(id dbus.ObjectPath) *dbus.Error {
+	idx, err := t.m.findTrack(id)
+	if err != nil {
+		return err
+	}
+	return toDBusError(t.m.player.Remove(idx))
+}
+
+func (t mprisTracks) GoTo(id dbus.ObjectPath) *dbus.Error {
+	idx, err := t.m.findTrack(id)
+	if err != nil {
+		return err
+	}
+	return toDBusError(t.m.player.Play(idx))
+}
@@ -0,0 +1,141 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-BUS Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`
+
+// 启动私有的会话总线，返回地址
+func startTestBus(t *testing.T) string {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err = ioutil.WriteFile(config, []byte(fmt.Sprintf(testBusConfig, filepath.Join(dir, "bus"))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address=1")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+func TestMPRIS(t *testing.T) {
+	addr := startTestBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	player := newTestPlayer(t)
+	music := silentMusic(t, "a b#1 晴天")
+	music.Info.MusicPicLocal = filepath.Join(filepath.Dir(music.Info.MusicLocal), "a b#1 晴天.jpg")
+	if err := player.Add(-1, music); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartMPRIS(player, func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 32)
+	conn.Signal(signals)
+
+	obj := conn.Object(mprisName, mprisPath)
+	status, err := obj.GetProperty(mprisPlayer + ".PlaybackStatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Value() != "Stopped" {
+		t.Errorf("PlaybackStatus = %v, want Stopped", status.Value())
+	}
+
+	// 切换歌曲时发出PropertiesChanged
+	if err = player.Play(0); err != nil {
+		t.Fatal(err)
+	}
+	var changed map[string]dbus.Variant
+	timeout := time.After(5 * time.Second)
+	for changed == nil {
+		select {
+		case sig := <-signals:
+			if len(sig.Body) < 2 || sig.Body[0] != mprisPlayer {
+				continue
+			}
+			props := sig.Body[1].(map[string]dbus.Variant)
+			if _, ok := props["Metadata"]; ok {
+				changed = props
+			}
+		case <-timeout:
+			t.Fatal("no PropertiesChanged for Metadata")
+		}
+	}
+	if status, err = obj.GetProperty(mprisPlayer + ".PlaybackStatus"); err != nil {
+		t.Fatal(err)
+	}
+	if status.Value() != "Playing" {
+		t.Errorf("PlaybackStatus = %v, want Playing", status.Value())
+	}
+
+	md := changed["Metadata"].Value().(map[string]dbus.Variant)
+	if got := md["xesam:title"].Value(); got != "a b#1 晴天" {
+		t.Errorf("xesam:title = %v", got)
+	}
+	for key, path := range map[string]string{"xesam:url": music.Info.MusicLocal, "mpris:artUrl": music.Info.MusicPicLocal} {
+		raw, _ := md[key].Value().(string)
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme != "file" || u.Host != "" || u.Path != path || strings.ContainsAny(raw, " #") {
+			t.Errorf("%s = %q, want escaped file url of %s", key, raw, path)
+		}
+	}
+	if _, ok := md["mpris:trackid"].Value().(dbus.ObjectPath); !ok {
+		t.Errorf("mpris:trackid = %v", md["mpris:trackid"])
+	}
+}
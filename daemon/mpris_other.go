@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import "errors"
+
+// MPRIS仅在Linux上可用
+func StartMPRIS(player *Player, quit func()) error {
+	return errors.New("mpris: only supported on linux")
+}
@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package daemon
+
+import (
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/lauthrul/goutil/log"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// 属性变化时的信号方式
+const (
+	emitTrue        = "true"
+	emitFalse       = "false"
+	emitConst       = "const"
+	emitInvalidates = "invalidates"
+)
+
+type mprisProp struct {
+	value dbus.Variant
+	emit  string
+	onSet func(v dbus.Variant) *dbus.Error // 为nil时只读
+}
+
+// org.freedesktop.DBus.Properties
+// prop包写入map时会与旧值合并，元数据需要整体替换，所以自己实现
+type mprisProps struct {
+	conn  *dbus.Conn
+	path  dbus.ObjectPath
+	mu    sync.RWMutex
+	props map[string]map[string]*mprisProp
+}
+
+func newMPRISProps(conn *dbus.Conn, path dbus.ObjectPath) *mprisProps {
+	return &mprisProps{conn: conn, path: path, props: map[string]map[string]*mprisProp{}}
+}
+
+func (p *mprisProps) add(iface, name string, value interface{}, emit string, onSet func(v dbus.Variant) *dbus.Error) {
+	if p.props[iface] == nil {
+		p.props[iface] = map[string]*mprisProp{}
+	}
+	p.props[iface][name] = &mprisProp{value: dbus.MakeVariant(value), emit: emit, onSet: onSet}
+}
+
+func (p *mprisProps) lookup(iface, name string) (*mprisProp, *dbus.Error) {
+	props, ok := p.props[iface]
+	if !ok {
+		return nil, prop.ErrIfaceNotFound
+	}
+	pp, ok := props[name]
+	if !ok {
+		return nil, prop.ErrPropNotFound
+	}
+	return pp, nil
+}
+
+func (p *mprisProps) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pp, err := p.lookup(iface, name)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	return pp.value, nil
+}
+
+func (p *mprisProps) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	props, ok := p.props[iface]
+	if !ok {
+		return nil, prop.ErrIfaceNotFound
+	}
+	res := map[string]dbus.Variant{}
+	for name, pp := range props {
+		res[name] = pp.value
+	}
+	return res, nil
+}
+
+// 写入交给播放器处理，新值随播放器事件更新
+func (p *mprisProps) Set(iface, name string, v dbus.Variant) *dbus.Error {
+	p.mu.RLock()
+	pp, err := p.lookup(iface, name)
+	p.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if pp.onSet == nil {
+		return prop.ErrReadOnly
+	}
+	if v.Signature() != pp.value.Signature() {
+		return prop.ErrInvalidArg
+	}
+	return pp.onSet(v)
+}
+
+func (p *mprisProps) value(iface, name string) interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.props[iface][name].value.Value()
+}
+
+// 值不变时不发信号
+func (p *mprisProps) set(iface, name string, value interface{}) {
+	p.mu.Lock()
+	pp := p.props[iface][name]
+	if reflect.DeepEqual(pp.value.Value(), value) {
+		p.mu.Unlock()
+		return
+	}
+	pp.value = dbus.MakeVariant(value)
+	p.mu.Unlock()
+
+	var err error
+	switch pp.emit {
+	case emitTrue:
+		err = p.conn.Emit(p.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+			iface, map[string]dbus.Variant{name: pp.value}, []string{})
+	case emitInvalidates:
+		err = p.conn.Emit(p.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+			iface, map[string]dbus.Variant{}, []string{name})
+	}
+	if err != nil {
+		log.Error("mpris emit properties changed err:", err)
+	}
+}
+
+func (p *mprisProps) introspection(iface string) []introspect.Property {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var res []introspect.Property
+	for name, pp := range p.props[iface] {
+		access := "read"
+		if pp.onSet != nil {
+			access = "readwrite"
+		}
+		res = append(res, introspect.Property{
+			Name:        name,
+			Type:        pp.value.Signature().String(),
+			Access:      access,
+			Annotations: []introspect.Annotation{{Name: "org.freedesktop.DBus.Property.EmitsChangedSignal", Value: pp.emit}},
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
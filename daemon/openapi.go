@@ -0,0 +1,205 @@
+package daemon
+
+// 控制接口的OpenAPI描述，GET /api/openapi.json
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "wander control API",
+    "version": "1.0.0",
+    "description": "Control a running wander daemon. Positions and durations are in milliseconds. Requests other than GET must send Content-Type: application/json. Without a token only same-origin requests from the local machine to localhost or an IP address are accepted."
+  },
+  "servers": [{"url": "http://127.0.0.1:6680"}],
+  "security": [{}, {"bearer": []}],
+  "paths": {
+    "/api/status": {
+      "get": {"summary": "Current playback status", "responses": {"200": {"$ref": "#/components/responses/Status"}}}
+    },
+    "/api/play": {
+      "post": {
+        "summary": "Resume playback, or play the queue item at index",
+        "requestBody": {"content": {"application/json": {"schema": {"type": "object", "properties": {"index": {"type": "integer"}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}, "502": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/pause": {
+      "post": {"summary": "Pause playback", "responses": {"200": {"$ref": "#/components/responses/Status"}}}
+    },
+    "/api/toggle": {
+      "post": {"summary": "Toggle play/pause", "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}}}
+    },
+    "/api/stop": {
+      "post": {"summary": "Stop playback", "responses": {"200": {"$ref": "#/components/responses/Status"}}}
+    },
+    "/api/seek": {
+      "post": {
+        "summary": "Seek to an absolute position or by a relative offset",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "properties": {"position": {"type": "integer"}, "offset": {"type": "integer"}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/next": {
+      "post": {"summary": "Play the next track according to the play mode", "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}}}
+    },
+    "/api/prev": {
+      "post": {"summary": "Play the previous track", "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}}}
+    },
+    "/api/volume": {
+      "put": {
+        "summary": "Set volume (0-100)",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["volume"], "properties": {"volume": {"type": "integer", "minimum": 0, "maximum": 100}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Status"}}
+      }
+    },
+    "/api/mode": {
+      "put": {
+        "summary": "Set play mode: 0 order, 1 shuffle, 2 repeat one",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["mode"], "properties": {"mode": {"type": "integer", "enum": [0, 1, 2]}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Status"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/queue": {
+      "get": {"summary": "Current queue", "responses": {"200": {"$ref": "#/components/responses/Queue"}}},
+      "post": {
+        "summary": "Add songs by id and/or a whole playlist; replace swaps the queue",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "properties": {
+          "ids": {"type": "array", "items": {"type": "string"}},
+          "playlist": {"type": "string", "description": "stored playlist id, NetEase playlist id or share url"},
+          "position": {"type": "integer", "description": "insert position, append when omitted"},
+          "replace": {"type": "boolean"}
+        }}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Queue"}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}, "502": {"$ref": "#/components/responses/Error"}}
+      },
+      "delete": {"summary": "Clear the queue", "responses": {"200": {"$ref": "#/components/responses/Queue"}}}
+    },
+    "/api/queue/move": {
+      "post": {
+        "summary": "Move a queue item",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object", "required": ["from", "to"], "properties": {"from": {"type": "integer"}, "to": {"type": "integer"}}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/Queue"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/queue/{index}": {
+      "delete": {
+        "summary": "Remove a queue item",
+        "parameters": [{"name": "index", "in": "path", "required": true, "schema": {"type": "integer"}}],
+        "responses": {"200": {"$ref": "#/components/responses/Queue"}, "400": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/charts": {
+      "get": {"summary": "Charts and stored playlists", "responses": {"200": {"description": "playlists", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Chart"}}}}}}}
+    },
+    "/api/charts/{id}": {
+      "get": {
+        "summary": "Tracks of a stored playlist, NetEase playlist id or share url",
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+        "responses": {"200": {"description": "tracks", "content": {"application/json": {"schema": {"type": "object", "properties": {"id": {"type": "string"}, "tracks": {"type": "array", "items": {"$ref": "#/components/schemas/Track"}}}}}}}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}, "502": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/cover/{index}": {
+      "get": {
+        "summary": "Cover image of a queue item, downloaded to the cache on first request",
+        "parameters": [{"name": "index", "in": "path", "required": true, "schema": {"type": "integer"}}, {"$ref": "#/components/parameters/Token"}],
+        "responses": {"200": {"description": "image", "content": {"image/*": {}}}, "400": {"$ref": "#/components/responses/Error"}, "404": {"$ref": "#/components/responses/Error"}, "502": {"$ref": "#/components/responses/Error"}}
+      }
+    },
+    "/api/lyric": {
+      "get": {
+        "summary": "All lyric lines of the current track; empty until loaded",
+        "responses": {"200": {"description": "lyric", "content": {"application/json": {"schema": {"type": "object", "properties": {"id": {"type": "string"}, "lines": {"type": "array", "items": {"$ref": "#/components/schemas/LyricLine"}}}}}}}}
+      }
+    },
+    "/api/events": {
+      "get": {
+        "summary": "Server-Sent Events stream: a snapshot event on connect, then incremental events",
+        "parameters": [{"$ref": "#/components/parameters/Token"}],
+        "responses": {"200": {"description": "each message data is an Event", "content": {"text/event-stream": {"schema": {"$ref": "#/components/schemas/Event"}}}}}
+      }
+    },
+    "/api/ws": {
+      "get": {
+        "summary": "WebSocket stream with the same Event messages as /api/events",
+        "parameters": [{"$ref": "#/components/parameters/Token"}],
+        "responses": {"101": {"description": "switching protocols"}}
+      }
+    },
+    "/api/search": {
+      "get": {
+        "summary": "Search songs, albums, artists or playlists",
+        "parameters": [
+          {"name": "q", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "type", "in": "query", "schema": {"type": "string", "enum": ["song", "album", "artist", "playlist"], "default": "song"}},
+          {"name": "page", "in": "query", "schema": {"type": "integer", "minimum": 1, "default": 1}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "default": 30}}
+        ],
+        "responses": {"200": {"description": "search result", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SearchResult"}}}}, "400": {"$ref": "#/components/responses/Error"}, "502": {"$ref": "#/components/responses/Error"}}
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer", "description": "required when the daemon is started with -token"}
+    },
+    "parameters": {
+      "Token": {"name": "token", "in": "query", "description": "bearer token for clients that cannot set headers", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Status": {"description": "playback status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}},
+      "Queue": {"description": "queue", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Queue"}}}},
+      "Error": {"description": "error", "content": {"application/json": {"schema": {"type": "object", "properties": {"error": {"type": "string"}}}}}}
+    },
+    "schemas": {
+      "Track": {"type": "object", "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "artists_name": {"type": "string"},
+        "album_name": {"type": "string"},
+        "duration": {"type": "integer", "description": "nanoseconds"},
+        "music_pic": {"type": "string"},
+        "music_local": {"type": "string"},
+        "music_pic_local": {"type": "string"}
+      }},
+      "Status": {"type": "object", "properties": {
+        "state": {"type": "string", "enum": ["stop", "play", "pause"]},
+        "track": {"$ref": "#/components/schemas/Track"},
+        "index": {"type": "integer"},
+        "position": {"type": "integer"},
+        "duration": {"type": "integer"},
+        "volume": {"type": "integer"},
+        "mode": {"type": "integer"},
+        "queue": {"type": "integer"},
+        "offline": {"type": "boolean"}
+      }},
+      "Queue": {"type": "object", "properties": {
+        "index": {"type": "integer"},
+        "tracks": {"type": "array", "items": {"$ref": "#/components/schemas/Track"}}
+      }},
+      "Chart": {"type": "object", "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "kind": {"type": "string", "enum": ["local", "remote", "virtual"]}
+      }},
+      "LyricLine": {"type": "object", "properties": {
+        "time": {"type": "integer", "description": "nanoseconds"},
+        "text": {"type": "string"},
+        "translation": {"type": "string"}
+      }},
+      "Event": {"type": "object", "properties": {
+        "id": {"type": "integer"},
+        "type": {"type": "string", "enum": ["snapshot", "track", "state", "position", "status", "queue", "lyric", "download", "error"]},
+        "time": {"type": "string", "format": "date-time"},
+        "data": {"description": "snapshot: {status, queue}; track: {index, track}; state: {state}; position: {position, duration}; status: Status; queue: Queue; lyric: {time, text, translation}; download: {name, url, received, total, done, error}; error: {error}"}
+      }},
+      "SearchResult": {"type": "object", "properties": {
+        "type": {"type": "string"},
+        "page": {"type": "integer"},
+        "pages": {"type": "integer"},
+        "total": {"type": "integer"},
+        "tracks": {"type": "array", "items": {"$ref": "#/components/schemas/Track"}},
+        "items": {"type": "array", "items": {"type": "object", "properties": {
+          "id": {"type": "string"}, "name": {"type": "string"}, "pic": {"type": "string"}, "owner": {"type": "string"}, "size": {"type": "integer"}
+        }}}
+      }}
+    }
+  }
+}
+`
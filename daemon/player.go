@@ -0,0 +1,463 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"sync"
+	"time"
+	"wander/model"
+)
+
+const (
+	StateStop  = "stop"
+	StatePlay  = "play"
+	StatePause = "pause"
+)
+
+var ErrQueueEmpty = errors.New("queue is empty")
+
+// 播放状态
+type Status struct {
+	State    string           `json:"state"`
+	Track    *model.MusicInfo `json:"track,omitempty"`
+	Index    int              `json:"index"`    // 当前歌曲在队列中的位置，-1表示没有
+	Position int64            `json:"position"` // 毫秒
+	Duration int64            `json:"duration"` // 毫秒
+	Volume   int              `json:"volume"`
+	Mode     model.PlayMode   `json:"mode"`
+	Queue    int              `json:"queue"` // 队列长度
+	Offline  bool             `json:"offline"`
+}
+
+type QueueInfo struct {
+	Index  int               `json:"index"`
+	Tracks []model.MusicInfo `json:"tracks"`
+}
+
+// 后台播放器，维护播放队列并在歌曲结束时自动切换
+type Player struct {
+	pm     *model.PlayerManager
+	store  *model.PlaylistStore
+	ranker *model.Ranker
+
+	events  *hub
+	mu      sync.Mutex
+	queue   []*model.Music
+	index   int
+	mode    model.PlayMode
+	playSeq int                  // 播放请求序号，下载完成时丢弃过期的请求
+	ids     map[*model.Music]int // 队列中歌曲的ID，供MPD、MPRIS等协议使用
+	nextID  int
+}
+
+func NewPlayer() *Player {
+	p := &Player{pm: model.NewPlayerManager(nil), events: newHub(), index: -1, ids: map[*model.Music]int{}}
+
+	var err error
+	if p.store, err = model.NewPlaylistStore(); err != nil {
+		log.Error("load playlist store err:", err)
+	}
+	favorites, err := model.NewFavoriteStore()
+	if err != nil {
+		log.Error("load favorite store err:", err)
+	}
+	p.store.AttachFavorites(favorites)
+	history, err := model.NewHistory()
+	if err != nil {
+		log.Error("load history err:", err)
+	}
+	p.pm.SetHistory(history)
+	blocklist, err := model.NewBlocklist()
+	if err != nil {
+		log.Error("load blocklist err:", err)
+	}
+	p.ranker = &model.Ranker{Blocklist: blocklist, History: history}
+
+	go p.watch()
+	go p.pump()
+	return p
+}
+
+func (p *Player) PlayerManager() *model.PlayerManager {
+	return p.pm
+}
+
+func (p *Player) Store() *model.PlaylistStore {
+	return p.store
+}
+
+// 当前歌曲播放结束时切换到下一首
+func (p *Player) watch() {
+	for range time.Tick(200 * time.Millisecond) {
+		if !p.pm.IsPlaying() {
+			continue
+		}
+		if pos, length := p.pm.Pos(), p.pm.Len(); length > 0 && pos >= length {
+			if err := p.next(true); err != nil {
+				log.Error("play next err:", err)
+				p.pm.Stop()
+				p.publishError(err)
+			}
+		}
+	}
+}
+
+// 恢复上次保存的队列、播放模式和音量
+func (p *Player) Restore() {
+	s, err := model.LoadSession()
+	if err != nil {
+		log.Error("load session err:", err)
+	}
+	if s == nil {
+		return
+	}
+	p.mu.Lock()
+	p.queue, p.index, p.mode = s.Musics(), s.Index, s.Mode
+	p.mu.Unlock()
+	p.pm.SetVolume(s.Volume)
+	p.publishQueue()
+}
+
+func (p *Player) Save() error {
+	p.mu.Lock()
+	s := &model.Session{Index: p.index, Mode: p.mode, Volume: p.pm.Volume()}
+	for _, m := range p.queue {
+		s.Queue = append(s.Queue, m.Info)
+	}
+	p.mu.Unlock()
+	if pos := p.pm.Pos(); pos > 0 {
+		s.Pos, s.Position = pos, p.pm.Duration(pos)
+	}
+	return model.SaveSession(s)
+}
+
+func (p *Player) Status() Status {
+	p.mu.Lock()
+	st := Status{Index: p.index, Mode: p.mode, Queue: len(p.queue)}
+	p.mu.Unlock()
+
+	st.State = StateStop
+	st.Volume = p.pm.Volume()
+	st.Offline = model.IsOffline()
+	if info := p.pm.Info(); info.ID != "" || info.MusicLocal != "" {
+		st.Track = &info
+		st.State = StatePause
+		if p.pm.IsPlaying() {
+			st.State = StatePlay
+		}
+		if pos := p.pm.Pos(); pos > 0 {
+			st.Position = p.pm.Duration(pos).Milliseconds()
+		}
+		if length := p.pm.Len(); length > 0 {
+			st.Duration = p.pm.Duration(length).Milliseconds()
+		}
+	}
+	return st
+}
+
+func (p *Player) Queue() QueueInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q := QueueInfo{Index: p.index, Tracks: []model.MusicInfo{}}
+	for _, m := range p.queue {
+		q.Tracks = append(q.Tracks, m.Info)
+	}
+	return q
+}
+
+// 队列中的歌曲，返回副本
+func (p *Player) Tracks() []*model.Music {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*model.Music(nil), p.queue...)
+}
+
+// 队列中第idx首的封面文件，没有缓存时下载
+func (p *Player) Cover(idx int) (string, error) {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.queue) {
+		p.mu.Unlock()
+		return "", model.ErrIndexOutOfRange
+	}
+	music := p.queue[idx]
+	info := music.Info
+	p.mu.Unlock()
+
+	if info.MusicPicLocal != "" {
+		return info.MusicPicLocal, nil
+	}
+	if info.MusicPic == "" {
+		return "", fmt.Errorf("cover %w", model.ErrNotFound)
+	}
+	// 歌曲可能正在播放，下载到副本后在锁内写回
+	if err := model.LoadPic(&info); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	p.pm.UpdateInfo(music, func(i *model.MusicInfo) { i.MusicPicLocal = info.MusicPicLocal })
+	p.mu.Unlock()
+	return info.MusicPicLocal, nil
+}
+
+// 歌曲在队列中的ID，歌曲留在队列中时保持不变
+func (p *Player) TrackID(m *model.Music) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.ids[m]
+	if !ok {
+		p.nextID++
+		id = p.nextID
+		p.ids[m] = id
+	}
+	return id
+}
+
+// 按ID查找歌曲在队列中的位置
+func (p *Player) FindTrack(id int) (int, *model.Music, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, m := range p.queue {
+		if tid, ok := p.ids[m]; ok && tid == id {
+			return i, m, nil
+		}
+	}
+	return -1, nil, model.ErrIndexOutOfRange
+}
+
+// 清理已移出队列的歌曲ID
+func (p *Player) pruneIDs() {
+	in := map[*model.Music]bool{}
+	for _, m := range p.queue {
+		in[m] = true
+	}
+	for m := range p.ids {
+		if !in[m] {
+			delete(p.ids, m)
+		}
+	}
+}
+
+// 播放队列中第idx首，下载完成后开始播放
+func (p *Player) Play(idx int) error {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.queue) {
+		p.mu.Unlock()
+		return model.ErrIndexOutOfRange
+	}
+	p.playSeq++
+	seq, music := p.playSeq, p.queue[idx]
+	p.mu.Unlock()
+
+	// 下载到副本，其他请求可能同时读取队列
+	info := music.Info
+	if err := model.LoadMusic(&info); err != nil {
+		p.publishError(err)
+		return err
+	}
+	// 封面供MPRIS、网页等显示，失败不影响播放
+	if info.MusicPic != "" {
+		if err := model.LoadPic(&info); err != nil {
+			log.Error("load music pic err:", err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pm.UpdateInfo(music, func(i *model.MusicInfo) { *i = info })
+	if seq != p.playSeq {
+		return nil
+	}
+	p.index = idx
+	p.pm.Stop()
+	if err := p.pm.Play(music, model.ActionPlay, -1); err != nil {
+		p.publishError(err)
+		return err
+	}
+	return nil
+}
+
+// 继续播放，没有正在播放的歌曲时播放队列当前位置
+func (p *Player) Resume() error {
+	if p.pm.Info().ID == "" && p.pm.Info().MusicLocal == "" {
+		p.mu.Lock()
+		idx := p.index
+		if idx < 0 {
+			idx = 0
+		}
+		n := len(p.queue)
+		p.mu.Unlock()
+		if n == 0 {
+			return ErrQueueEmpty
+		}
+		return p.Play(idx)
+	}
+	return p.pm.Play(nil, model.ActionPlay, -1)
+}
+
+func (p *Player) Pause() {
+	if p.pm.IsPlaying() {
+		p.pm.Play(nil, model.ActionPause, -1)
+	}
+}
+
+func (p *Player) Toggle() error {
+	if p.pm.IsPlaying() {
+		p.Pause()
+		return nil
+	}
+	return p.Resume()
+}
+
+func (p *Player) Stop() {
+	p.pm.Stop()
+}
+
+// 定位到指定位置
+func (p *Player) Seek(pos time.Duration) {
+	if cur := p.pm.Pos(); cur >= 0 {
+		p.pm.SeekBy(pos - p.pm.Duration(cur))
+	}
+}
+
+func (p *Player) SeekBy(d time.Duration) {
+	p.pm.SeekBy(d)
+}
+
+func (p *Player) Next() error {
+	return p.next(false)
+}
+
+// auto为true时表示当前歌曲播放结束自动切换
+func (p *Player) next(auto bool) error {
+	p.mu.Lock()
+	mode := p.mode
+	if mode == model.PlayModeRepeatOne && !auto {
+		mode = model.PlayModeOrder
+	}
+	idx := p.ranker.NextIndex(p.queue, p.index, 1, mode)
+	p.mu.Unlock()
+	if idx < 0 {
+		return ErrQueueEmpty
+	}
+	return p.Play(idx)
+}
+
+func (p *Player) Prev() error {
+	p.mu.Lock()
+	mode := p.mode
+	if mode == model.PlayModeRepeatOne {
+		mode = model.PlayModeOrder
+	}
+	idx := p.ranker.NextIndex(p.queue, p.index, -1, mode)
+	p.mu.Unlock()
+	if idx < 0 {
+		return ErrQueueEmpty
+	}
+	return p.Play(idx)
+}
+
+func (p *Player) SetVolume(volume int) {
+	p.pm.SetVolume(volume)
+	p.publishStatus()
+}
+
+func (p *Player) SetMode(mode model.PlayMode) error {
+	if mode < model.PlayModeOrder || mode > model.PlayModeRepeatOne {
+		return model.ErrIndexOutOfRange
+	}
+	p.mu.Lock()
+	p.mode = mode
+	p.mu.Unlock()
+	p.publishStatus()
+	return nil
+}
+
+// 在pos处插入歌曲，pos<0时追加到末尾
+func (p *Player) Add(pos int, musics ...*model.Music) error {
+	p.mu.Lock()
+	if pos < 0 {
+		pos = len(p.queue)
+	}
+	if pos > len(p.queue) {
+		p.mu.Unlock()
+		return model.ErrIndexOutOfRange
+	}
+	p.queue = append(p.queue[:pos], append(append([]*model.Music(nil), musics...), p.queue[pos:]...)...)
+	if p.index >= pos {
+		p.index += len(musics)
+	}
+	p.mu.Unlock()
+	p.publishQueue()
+	return nil
+}
+
+// 追加到队列末尾并播放其中第一首
+func (p *Player) PlayNow(musics ...*model.Music) error {
+	if len(musics) == 0 {
+		return ErrQueueEmpty
+	}
+	if err := p.Add(-1, musics...); err != nil {
+		return err
+	}
+	idx, _, err := p.FindTrack(p.TrackID(musics[0]))
+	if err != nil {
+		return err
+	}
+	return p.Play(idx)
+}
+
+// 替换整个队列
+func (p *Player) Replace(musics []*model.Music) {
+	p.mu.Lock()
+	p.queue, p.index = musics, -1
+	p.playSeq++
+	p.pruneIDs()
+	p.mu.Unlock()
+	p.pm.Stop()
+	p.publishQueue()
+}
+
+func (p *Player) Remove(idx int) error {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.queue) {
+		p.mu.Unlock()
+		return model.ErrIndexOutOfRange
+	}
+	p.queue = append(p.queue[:idx], p.queue[idx+1:]...)
+	// 移除正在播放的歌曲时不打断播放，下一首从原位置开始
+	if idx <= p.index {
+		p.index--
+	}
+	p.pruneIDs()
+	p.mu.Unlock()
+	p.publishQueue()
+	return nil
+}
+
+func (p *Player) Move(from, to int) error {
+	p.mu.Lock()
+	n := len(p.queue)
+	if from < 0 || from >= n || to < 0 || to >= n {
+		p.mu.Unlock()
+		return model.ErrIndexOutOfRange
+	}
+	music := p.queue[from]
+	p.queue = append(p.queue[:from], p.queue[from+1:]...)
+	p.queue = append(p.queue[:to], append([]*model.Music{music}, p.queue[to:]...)...)
+	switch {
+	case p.index == from:
+		p.index = to
+	case from < p.index && to >= p.index:
+		p.index--
+	case from > p.index && to <= p.index:
+		p.index++
+	}
+	p.mu.Unlock()
+	p.publishQueue()
+	return nil
+}
+
+func (p *Player) Clear() {
+	p.Replace(nil)
+}
@@ -0,0 +1,37 @@
+package daemon
+
+import "wander/model"
+
+// 处理其他进程转发的命令
+type remote struct{ p *Player }
+
+// 追加到队列并播放
+func (r remote) Play(target string) error {
+	musics, err := model.ResolveTracks(target)
+	if err != nil {
+		return err
+	}
+	return r.p.PlayNow(musics...)
+}
+
+func (r remote) Next() error {
+	return r.p.Next()
+}
+
+func (r remote) Prev() error {
+	return r.p.Prev()
+}
+
+func (r remote) Toggle() error {
+	return r.p.Toggle()
+}
+
+func (r remote) Pause() error {
+	r.p.Pause()
+	return nil
+}
+
+func (r remote) Stop() error {
+	r.p.Stop()
+	return nil
+}
@@ -0,0 +1,538 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"wander/model"
+)
+
+const DefaultAddr = "127.0.0.1:6680"
+
+// 以unix:开头的地址表示Unix socket，如unix:/tmp/wander.sock
+const unixPrefix = "unix:"
+
+type Options struct {
+	Addr    string
+	MPDAddr string // MPD协议监听地址，为空时不启用
+	Token   string // 不为空时要求请求携带 Authorization: Bearer <Token>，或使用?token=参数
+	MPRIS   bool   // 在D-Bus会话总线上注册MPRIS，仅Linux有效
+}
+
+// 控制接口
+type Server struct {
+	player *Player
+	opts   Options
+	mux    *http.ServeMux
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type searchResult struct {
+	Type   string             `json:"type"`
+	Page   int                `json:"page"`
+	Pages  int                `json:"pages"`
+	Total  int                `json:"total"`
+	Tracks []model.MusicInfo  `json:"tracks,omitempty"`
+	Items  []model.SearchItem `json:"items,omitempty"`
+}
+
+type chartInfo struct {
+	ID   string             `json:"id"`
+	Name string             `json:"name"`
+	Kind model.PlaylistKind `json:"kind"`
+}
+
+type chartTracks struct {
+	ID     string            `json:"id"`
+	Tracks []model.MusicInfo `json:"tracks"`
+}
+
+type lyricResult struct {
+	ID    string            `json:"id"`
+	Lines []model.LyricLine `json:"lines"`
+}
+
+// 请求参数
+type (
+	playReq struct {
+		Index *int `json:"index"`
+	}
+	seekReq struct {
+		Position *int64 `json:"position"` // 毫秒
+		Offset   *int64 `json:"offset"`   // 毫秒，相对当前位置
+	}
+	volumeReq struct {
+		Volume int `json:"volume"`
+	}
+	modeReq struct {
+		Mode model.PlayMode `json:"mode"`
+	}
+	queueAddReq struct {
+		IDs      []string `json:"ids"`
+		Playlist string   `json:"playlist"`
+		Position *int     `json:"position"`
+		Replace  bool     `json:"replace"`
+	}
+	queueMoveReq struct {
+		From int `json:"from"`
+		To   int `json:"to"`
+	}
+)
+
+func NewServer(player *Player, opts Options) *Server {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	s := &Server{player: player, opts: opts, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/openapi.json", s.onOpenAPI)
+	s.handle("/api/status", http.MethodGet, s.onStatus)
+	s.handle("/api/play", http.MethodPost, s.onPlay)
+	s.handle("/api/pause", http.MethodPost, s.onPause)
+	s.handle("/api/toggle", http.MethodPost, s.onToggle)
+	s.handle("/api/stop", http.MethodPost, s.onStop)
+	s.handle("/api/seek", http.MethodPost, s.onSeek)
+	s.handle("/api/next", http.MethodPost, s.onNext)
+	s.handle("/api/prev", http.MethodPost, s.onPrev)
+	s.handle("/api/volume", http.MethodPut, s.onVolume)
+	s.handle("/api/mode", http.MethodPut, s.onMode)
+	s.handle("/api/queue", "", s.onQueue)
+	s.handle("/api/queue/move", http.MethodPost, s.onQueueMove)
+	s.handle("/api/queue/", http.MethodDelete, s.onQueueRemove)
+	s.handle("/api/charts", http.MethodGet, s.onCharts)
+	s.handle("/api/charts/", http.MethodGet, s.onChart)
+	s.handle("/api/cover/", http.MethodGet, s.onCover)
+	s.handle("/api/lyric", http.MethodGet, s.onLyric)
+	s.handle("/api/search", http.MethodGet, s.onSearch)
+	s.handle("/api/events", http.MethodGet, s.onEvents)
+	s.handle("/api/ws", http.MethodGet, s.onWebSocket)
+	// 网页本身不需要认证，接口请求时再要求令牌
+	s.mux.Handle("/", webHandler())
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// 注册需要认证的接口，method为空时由handler自行判断
+func (s *Server) handle(path, method string, h http.HandlerFunc) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wander"`)
+			writeJson(w, http.StatusUnauthorized, apiError{"unauthorized"})
+			return
+		}
+		if !s.sameOrigin(r) {
+			writeJson(w, http.StatusForbidden, apiError{"cross-origin request forbidden"})
+			return
+		}
+		if method != "" && r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJson(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+			return
+		}
+		// 网页只能跨域发送text/plain等简单请求，要求json可以阻止其他网页直接控制播放
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !isJson(r) {
+			writeJson(w, http.StatusUnsupportedMediaType, apiError{"Content-Type must be application/json"})
+			return
+		}
+		h(w, r)
+	})
+}
+
+func isJson(r *http.Request) bool {
+	typ, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && typ == "application/json"
+}
+
+// 未设置令牌时只接受本机发起的同源请求：
+// 对方地址必须是回环地址，监听0.0.0.0时局域网内的其他设备需要令牌；
+// Origin必须与Host一致，防止其他网页跨域调用；Host必须是localhost或IP，防止DNS重绑定
+func (s *Server) sameOrigin(r *http.Request) bool {
+	if s.opts.Token != "" {
+		return true
+	}
+	if !strings.HasPrefix(s.opts.Addr, unixPrefix) && (!isLoopback(r.RemoteAddr) || !isLocalHost(r.Host)) {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return false
+		}
+	}
+	return true
+}
+
+// 重绑定需要域名，IP地址和localhost不受影响
+func isLocalHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
+
+func isLoopback(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return true
+	}
+	// 浏览器的EventSource、WebSocket无法设置请求头，允许通过参数传递
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+// 监听TCP地址或Unix socket
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		path := strings.TrimPrefix(addr, unixPrefix)
+		// 清理上次异常退出残留的socket文件
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := Listen(s.opts.Addr)
+	if err != nil {
+		return err
+	}
+	log.Debug("daemon listen on", s.opts.Addr)
+	return http.Serve(l, s.mux)
+}
+
+func writeJson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+// 按错误类型返回对应的状态码
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, model.ErrIndexOutOfRange), errors.Is(err, model.ErrInvalidPlaylist), errors.Is(err, ErrQueueEmpty):
+		code = http.StatusBadRequest
+	case errors.Is(err, model.ErrNotFound):
+		code = http.StatusNotFound
+	case model.IsNetworkError(err), model.IsDecodeError(err):
+		code = http.StatusBadGateway
+	}
+	writeJson(w, code, apiError{err.Error()})
+}
+
+// 解析请求体，允许为空
+func decodeBody(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) badRequest(w http.ResponseWriter, err error) {
+	writeJson(w, http.StatusBadRequest, apiError{err.Error()})
+}
+
+// 操作成功后返回最新状态
+func (s *Server) result(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, s.player.Status())
+}
+
+func (s *Server) onStatus(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, s.player.Status())
+}
+
+func (s *Server) onPlay(w http.ResponseWriter, r *http.Request) {
+	var req playReq
+	if err := decodeBody(r, &req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if req.Index != nil {
+		s.result(w, s.player.Play(*req.Index))
+		return
+	}
+	s.result(w, s.player.Resume())
+}
+
+func (s *Server) onPause(w http.ResponseWriter, r *http.Request) {
+	s.player.Pause()
+	s.result(w, nil)
+}
+
+func (s *Server) onToggle(w http.ResponseWriter, r *http.Request) {
+	s.result(w, s.player.Toggle())
+}
+
+func (s *Server) onStop(w http.ResponseWriter, r *http.Request) {
+	s.player.Stop()
+	s.result(w, nil)
+}
+
+func (s *Server) onSeek(w http.ResponseWriter, r *http.Request) {
+	var req seekReq
+	if err := decodeBody(r, &req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	switch {
+	case req.Position != nil:
+		s.player.Seek(time.Duration(*req.Position) * time.Millisecond)
+	case req.Offset != nil:
+		s.player.SeekBy(time.Duration(*req.Offset) * time.Millisecond)
+	default:
+		s.badRequest(w, fmt.Errorf("position or offset required"))
+		return
+	}
+	s.result(w, nil)
+}
+
+func (s *Server) onNext(w http.ResponseWriter, r *http.Request) {
+	s.result(w, s.player.Next())
+}
+
+func (s *Server) onPrev(w http.ResponseWriter, r *http.Request) {
+	s.result(w, s.player.Prev())
+}
+
+func (s *Server) onVolume(w http.ResponseWriter, r *http.Request) {
+	var req volumeReq
+	if err := decodeBody(r, &req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	s.player.SetVolume(req.Volume)
+	s.result(w, nil)
+}
+
+func (s *Server) onMode(w http.ResponseWriter, r *http.Request) {
+	var req modeReq
+	if err := decodeBody(r, &req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	s.result(w, s.player.SetMode(req.Mode))
+}
+
+func (s *Server) onQueue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req queueAddReq
+		if err := decodeBody(r, &req); err != nil {
+			s.badRequest(w, err)
+			return
+		}
+		if req.Playlist == "" && len(req.IDs) == 0 {
+			s.badRequest(w, fmt.Errorf("ids or playlist required"))
+			return
+		}
+		musics, err := s.resolve(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.Replace {
+			s.player.Replace(musics)
+		} else {
+			pos := -1
+			if req.Position != nil {
+				pos = *req.Position
+			}
+			if err = s.player.Add(pos, musics...); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+	case http.MethodDelete:
+		s.player.Clear()
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJson(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+		return
+	}
+	writeJson(w, http.StatusOK, s.player.Queue())
+}
+
+// 要加入队列的歌曲
+func (s *Server) resolve(req queueAddReq) ([]*model.Music, error) {
+	var musics []*model.Music
+	if req.Playlist != "" {
+		id, list, err := s.player.Store().Load(req.Playlist)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range list {
+			m.Source = id
+		}
+		musics = append(musics, list...)
+	}
+	if len(req.IDs) > 0 {
+		list, err := model.RequestSongDetails(req.IDs)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("songs %w", model.ErrNotFound)
+		}
+		musics = append(musics, list...)
+	}
+	return musics, nil
+}
+
+func (s *Server) onQueueMove(w http.ResponseWriter, r *http.Request) {
+	var req queueMoveReq
+	if err := decodeBody(r, &req); err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err := s.player.Move(req.From, req.To); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, s.player.Queue())
+}
+
+// DELETE /api/queue/{index}
+func (s *Server) onQueueRemove(w http.ResponseWriter, r *http.Request) {
+	idx, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/queue/"))
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	if err = s.player.Remove(idx); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusOK, s.player.Queue())
+}
+
+func (s *Server) onCharts(w http.ResponseWriter, r *http.Request) {
+	charts := []chartInfo{}
+	for _, p := range s.player.Store().List() {
+		charts = append(charts, chartInfo{ID: p.ID, Name: p.Name, Kind: p.Kind})
+	}
+	writeJson(w, http.StatusOK, charts)
+}
+
+// GET /api/charts/{id}，id可以是已保存的歌单、网易云歌单ID或分享链接
+func (s *Server) onChart(w http.ResponseWriter, r *http.Request) {
+	id, musics, err := s.player.Store().Load(strings.TrimPrefix(r.URL.Path, "/api/charts/"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res := chartTracks{ID: id, Tracks: []model.MusicInfo{}}
+	for _, m := range musics {
+		res.Tracks = append(res.Tracks, m.Info)
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// GET /api/cover/{index}，队列中歌曲的封面，优先使用缓存
+func (s *Server) onCover(w http.ResponseWriter, r *http.Request) {
+	idx, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/cover/"))
+	if err != nil {
+		s.badRequest(w, err)
+		return
+	}
+	path, err := s.player.Cover(idx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeFile(w, r, path)
+}
+
+// 当前歌曲的全部歌词
+func (s *Server) onLyric(w http.ResponseWriter, r *http.Request) {
+	pm := s.player.PlayerManager()
+	res := lyricResult{ID: pm.Info().ID, Lines: []model.LyricLine{}}
+	if lyric := pm.Lyric(); lyric != nil {
+		res.Lines = lyric.Lines
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// GET /api/search?q=&type=song&page=1&limit=30
+func (s *Server) onSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	typ := query.Get("type")
+	if typ == "" {
+		typ = "song"
+	}
+	if query.Get("q") == "" {
+		s.badRequest(w, fmt.Errorf("q required"))
+		return
+	}
+	st, ok := model.SearchTypeNames[typ]
+	if !ok {
+		s.badRequest(w, fmt.Errorf("unknown search type: %s", typ))
+		return
+	}
+	page, limit := 1, model.DefaultSearchLimit
+	if v := query.Get("page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			page = n
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	res, err := model.Search(query.Get("q"), st, page-1, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := searchResult{Type: typ, Page: page, Pages: res.Pages(), Total: res.Total, Items: res.Items}
+	for _, m := range res.Musics {
+		out.Tracks = append(out.Tracks, m.Info)
+	}
+	writeJson(w, http.StatusOK, out)
+}
+
+func (s *Server) onOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = io.WriteString(w, openAPI)
+}
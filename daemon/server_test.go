@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wander/model"
+)
+
+// 使用临时数据目录的播放器
+func newTestPlayer(t *testing.T) *Player {
+	dataDir := model.DataDir
+	model.DataDir = t.TempDir()
+	t.Cleanup(func() { model.DataDir = dataDir })
+	p := NewPlayer()
+	t.Cleanup(p.Stop)
+	return p
+}
+
+// 在临时目录生成约10秒的静音mp3，返回可播放的歌曲
+func silentMusic(t *testing.T, name string) *model.Music {
+	// MPEG-1 Layer III，128kbps，44.1kHz，单声道，内容全为0的帧解码为静音
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0xC0})
+	path := filepath.Join(t.TempDir(), name+".mp3")
+	if err := ioutil.WriteFile(path, bytes.Repeat(frame, 400), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &model.Music{Info: model.MusicInfo{Name: name, ArtistsName: "wander", MusicLocal: path}}
+}
+
+func newTestServer(t *testing.T, opts Options) http.Handler {
+	return NewServer(newTestPlayer(t), opts).Handler()
+}
+
+func TestServerRejectsCrossSite(t *testing.T) {
+	h := newTestServer(t, Options{Addr: DefaultAddr})
+	const local = "127.0.0.1:50000"
+	tests := []struct {
+		name        string
+		method      string
+		remote      string
+		host        string
+		origin      string
+		contentType string
+		want        int
+	}{
+		{"status", http.MethodGet, local, "127.0.0.1:6680", "", "", http.StatusOK},
+		{"status localhost", http.MethodGet, "[::1]:50000", "localhost:6680", "http://localhost:6680", "", http.StatusOK},
+		{"rebinding", http.MethodGet, local, "evil.example:6680", "", "", http.StatusForbidden},
+		{"cross origin", http.MethodGet, local, "127.0.0.1:6680", "http://evil.example", "", http.StatusForbidden},
+		{"lan without token", http.MethodGet, "192.168.1.20:50000", "192.168.1.10:6680", "", "", http.StatusForbidden},
+		{"lan post without token", http.MethodPost, "192.168.1.20:50000", "192.168.1.10:6680", "", "application/json", http.StatusForbidden},
+		{"simple post", http.MethodPost, local, "127.0.0.1:6680", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, local, "127.0.0.1:6680", "", "", http.StatusUnsupportedMediaType},
+		{"json post", http.MethodPost, local, "127.0.0.1:6680", "", "application/json; charset=utf-8", http.StatusBadRequest}, // 队列为空
+	}
+	for _, tt := range tests {
+		path := "/api/status"
+		if tt.method == http.MethodPost {
+			path = "/api/next"
+		}
+		r := httptest.NewRequest(tt.method, path, strings.NewReader(""))
+		r.Host, r.RemoteAddr = tt.host, tt.remote
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+// 设置令牌后允许其他来源，如局域网内的手机
+func TestServerTokenAllowsOrigin(t *testing.T) {
+	h := newTestServer(t, Options{Addr: "0.0.0.0:6680", Token: "secret"})
+	r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	r.Host = "wander.lan:6680"
+	r.Header.Set("Origin", "http://other.lan")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, want 401", w.Code)
+	}
+
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("with token: status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/lauthrul/goutil/log"
+	"net/http"
+	"time"
+)
+
+const (
+	eventBuffer   = 64
+	keepAlive     = 15 * time.Second
+	wsWriteWait   = 10 * time.Second
+	wsPingPeriod  = 30 * time.Second
+	wsPongTimeout = wsPingPeriod + 10*time.Second
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// GET /api/events，Server-Sent Events推送，连接时先发送snapshot
+func (s *Server) onEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJson(w, http.StatusInternalServerError, apiError{"streaming unsupported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ch, snapshot := s.player.Subscribe(eventBuffer)
+	defer s.player.Unsubscribe(ch)
+	writeSSE(w, snapshot)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				// 处理不及时，结束后浏览器自动重连并获取新的snapshot
+				return
+			}
+			writeSSE(w, ev)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Error("marshal event err:", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, data)
+}
+
+// GET /api/ws，WebSocket推送，消息格式与SSE相同
+func (s *Server) onWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("websocket upgrade err:", err)
+		return
+	}
+	defer conn.Close()
+
+	ch, snapshot := s.player.Subscribe(eventBuffer)
+	defer s.player.Unsubscribe(ch)
+
+	// 客户端不发送消息，读取只用于处理pong和关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(ev Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(ev)
+	}
+	if err = write(snapshot); err != nil {
+		return
+	}
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect for a new snapshot")
+				_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+				return
+			}
+			if err = write(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
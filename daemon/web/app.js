@@ -0,0 +1,505 @@
+'use strict';
+
+// 通过控制接口和事件流操作后台服务，令牌可通过?token=传入或首次请求时输入
+const $ = sel => document.querySelector(sel);
+
+const MODES = ['顺序', '随机', '单曲'];
+
+const state = {
+  status: { state: 'stop', index: -1, position: 0, duration: 0, volume: 0, mode: 0 },
+  queue: { index: -1, tracks: [] },
+  lyric: { id: null, lines: [], current: -1 },
+  seeking: false,
+  chart: null,
+  search: { q: '', type: 'song', page: 1, pages: 0 },
+};
+
+let token = new URLSearchParams(location.search).get('token') || localStorage.getItem('wander.token') || '';
+if (token) localStorage.setItem('wander.token', token);
+
+// ---------- 接口 ----------
+
+let asking = false;
+
+function askToken() {
+  if (asking) return;
+  asking = true;
+  const t = prompt('请输入访问令牌');
+  asking = false;
+  if (t !== null) {
+    token = t.trim();
+    localStorage.setItem('wander.token', token);
+    connect();
+  }
+}
+
+async function api(method, path, body) {
+  const opts = { method, headers: {} };
+  if (token) opts.headers.Authorization = 'Bearer ' + token;
+  // 服务端要求修改类请求使用json
+  if (method !== 'GET') opts.headers['Content-Type'] = 'application/json';
+  if (body !== undefined) opts.body = JSON.stringify(body);
+  const resp = await fetch(path, opts);
+  if (resp.status === 401) {
+    askToken();
+    throw new Error('未授权');
+  }
+  const data = await resp.json().catch(() => ({}));
+  if (!resp.ok) throw new Error(data.error || resp.statusText);
+  return data;
+}
+
+// 浏览器的img、EventSource无法设置请求头
+function withToken(url) {
+  if (!token) return url;
+  return url + (url.includes('?') ? '&' : '?') + 'token=' + encodeURIComponent(token);
+}
+
+function run(promise) {
+  return promise.catch(err => toast(err.message));
+}
+
+// ---------- 事件流 ----------
+
+let source;
+
+function connect() {
+  if (source) source.close();
+  source = new EventSource(withToken('/api/events'));
+  source.onmessage = e => onEvent(JSON.parse(e.data));
+  source.onerror = () => {
+    // 认证失败时EventSource不会自动重连
+    if (source.readyState === EventSource.CLOSED) {
+      setTimeout(() => api('GET', '/api/status').then(connect, () => {}), 3000);
+    }
+  };
+}
+
+function onEvent(ev) {
+  const d = ev.data;
+  switch (ev.type) {
+    case 'snapshot':
+      state.status = d.status;
+      state.queue = d.queue;
+      renderNow();
+      renderQueue();
+      loadLyric();
+      break;
+    case 'track':
+      state.status.index = state.queue.index = d.index;
+      state.status.track = d.track;
+      renderNow();
+      renderQueue();
+      loadLyric();
+      break;
+    case 'state':
+      state.status.state = d.state;
+      renderControls();
+      break;
+    case 'position':
+      state.status.position = d.position;
+      state.status.duration = d.duration;
+      renderProgress();
+      break;
+    case 'status':
+      state.status = d;
+      state.queue.index = d.index;
+      renderNow();
+      break;
+    case 'queue':
+      state.queue = d;
+      renderQueue();
+      break;
+    case 'lyric':
+      onLyricLine(d);
+      break;
+    case 'download':
+      renderDownload(d);
+      break;
+    case 'error':
+      toast(d.error);
+      break;
+  }
+}
+
+// ---------- 正在播放 ----------
+
+function fmtTime(ms) {
+  const s = Math.max(0, Math.floor(ms / 1000));
+  return Math.floor(s / 60) + ':' + String(s % 60).padStart(2, '0');
+}
+
+function currentTrack() {
+  return state.status.track || null;
+}
+
+function renderNow() {
+  const track = currentTrack();
+  $('#title').textContent = track ? track.name : '漫游中…';
+  $('#artist').textContent = track ? [track.artists_name, track.album_name].filter(Boolean).join(' - ') : '';
+  document.title = track ? track.name + ' - wander' : 'wander';
+
+  const img = $('#cover');
+  const idx = state.status.index;
+  if (track && idx >= 0 && (track.music_pic || track.music_pic_local)) {
+    const src = withToken('/api/cover/' + idx + '?v=' + encodeURIComponent(track.id || track.name));
+    if (img.dataset.src !== src) {
+      img.dataset.src = src;
+      img.hidden = false;
+      img.src = src;
+    }
+  } else {
+    img.hidden = true;
+    img.removeAttribute('src');
+    delete img.dataset.src;
+  }
+  renderControls();
+  renderProgress();
+}
+
+function renderControls() {
+  const st = state.status;
+  $('#toggle').textContent = st.state === 'play' ? '❚❚' : '▶';
+  $('#mode').textContent = MODES[st.mode] || MODES[0];
+  if (document.activeElement !== $('#volume')) $('#volume').value = st.volume;
+}
+
+function renderProgress() {
+  if (state.seeking) return;
+  const st = state.status;
+  const seek = $('#seek');
+  seek.max = st.duration || 0;
+  seek.value = st.position || 0;
+  $('#pos').textContent = fmtTime(st.position);
+  $('#dur').textContent = fmtTime(st.duration);
+}
+
+function renderDownload(d) {
+  const el = $('#download');
+  if (d.done) {
+    el.hidden = true;
+    return;
+  }
+  const pct = d.total > 0 ? Math.floor(d.received * 100 / d.total) + '%' : Math.floor(d.received / 1024) + 'KB';
+  el.textContent = '下载 ' + d.name.replace(/^cache\//, '') + ' ' + pct;
+  el.hidden = false;
+}
+
+let toastTimer;
+
+function toast(msg) {
+  const el = $('#toast');
+  el.textContent = msg;
+  el.hidden = false;
+  clearTimeout(toastTimer);
+  toastTimer = setTimeout(() => { el.hidden = true; }, 3000);
+}
+
+// ---------- 歌词 ----------
+
+let lyricRetry;
+
+// 歌词在切歌后异步加载，未就绪时稍后重试
+function loadLyric(retries = 3) {
+  clearTimeout(lyricRetry);
+  const track = currentTrack();
+  if (!track) {
+    renderLyric({ id: null, lines: [] });
+    return;
+  }
+  run(api('GET', '/api/lyric').then(res => {
+    renderLyric(res);
+    if (res.lines.length === 0 && retries > 0) {
+      lyricRetry = setTimeout(() => loadLyric(retries - 1), 1500);
+    }
+  }));
+}
+
+function renderLyric(res) {
+  state.lyric = { id: res.id, lines: res.lines, current: -1 };
+  const list = $('#lyric');
+  list.replaceChildren();
+  if (res.lines.length === 0) {
+    list.append(el('li', 'empty', currentTrack() ? '暂无歌词' : ''));
+    return;
+  }
+  for (const line of res.lines) {
+    const li = el('li', '', line.text);
+    if (line.translation) li.append(el('span', 'tr', line.translation));
+    list.append(li);
+  }
+}
+
+function onLyricLine(line) {
+  const track = currentTrack();
+  if (track && state.lyric.id !== track.id) {
+    loadLyric();
+    return;
+  }
+  const idx = state.lyric.lines.findIndex(l => l.time === line.time);
+  if (idx < 0 || idx === state.lyric.current) return;
+  const items = $('#lyric').children;
+  if (items[state.lyric.current]) items[state.lyric.current].classList.remove('current');
+  state.lyric.current = idx;
+  items[idx].classList.add('current');
+  if ($('#tab-lyric').classList.contains('active')) {
+    items[idx].scrollIntoView({ block: 'center', behavior: 'smooth' });
+  }
+}
+
+// ---------- 列表 ----------
+
+function el(tag, cls, text) {
+  const e = document.createElement(tag);
+  if (cls) e.className = cls;
+  if (text !== undefined) e.textContent = text;
+  return e;
+}
+
+function trackItem(track, num) {
+  const li = el('li');
+  if (num !== undefined) li.append(el('span', 'num', String(num)));
+  const info = el('div', 'info');
+  info.append(el('div', 'name', track.name));
+  const sub = [track.artists_name, track.album_name].filter(Boolean).join(' - ');
+  info.append(el('div', 'sub', sub || ' '));
+  li.append(info);
+  if (track.duration > 0) li.append(el('span', 'sub', fmtTime(track.duration / 1e6)));
+  return li;
+}
+
+function iconButton(text, title, onClick) {
+  const b = el('button', '', text);
+  b.title = title;
+  b.addEventListener('click', e => {
+    e.stopPropagation();
+    onClick();
+  });
+  return b;
+}
+
+function renderQueue() {
+  const list = $('#queue');
+  const tracks = state.queue.tracks;
+  $('#queue-info').textContent = tracks.length ? '共' + tracks.length + '首' : '';
+  list.replaceChildren();
+  if (tracks.length === 0) {
+    list.append(el('li', 'empty', '队列为空，去榜单或搜索添加歌曲'));
+    return;
+  }
+  tracks.forEach((track, i) => {
+    const li = trackItem(track);
+    li.dataset.index = i;
+    if (i === state.queue.index) li.classList.add('current');
+    const handle = el('span', 'handle', '≡');
+    handle.title = '拖动排序';
+    handle.addEventListener('pointerdown', e => startDrag(e, li, handle));
+    handle.addEventListener('click', e => e.stopPropagation());
+    li.prepend(handle);
+    li.append(iconButton('✕', '移出队列', () => run(api('DELETE', '/api/queue/' + i))));
+    li.addEventListener('click', () => run(api('POST', '/api/play', { index: i })));
+    list.append(li);
+  });
+}
+
+// 拖动排序，使用Pointer Events以支持触屏
+function startDrag(e, li, handle) {
+  e.preventDefault();
+  const list = $('#queue');
+  const scroller = $('#tab-queue');
+  const from = Number(li.dataset.index);
+  let to = from;
+  li.classList.add('dragging');
+  handle.setPointerCapture(e.pointerId);
+
+  const move = ev => {
+    // 靠近边缘时滚动列表
+    const rect = scroller.getBoundingClientRect();
+    if (ev.clientY < rect.top + 40) scroller.scrollTop -= 10;
+    else if (ev.clientY > rect.bottom - 40) scroller.scrollTop += 10;
+
+    const over = document.elementFromPoint(ev.clientX, ev.clientY);
+    const target = over && over.closest('#queue li');
+    if (!target || target === li) return;
+    const r = target.getBoundingClientRect();
+    list.insertBefore(li, ev.clientY > r.top + r.height / 2 ? target.nextSibling : target);
+    to = Array.prototype.indexOf.call(list.children, li);
+  };
+  const end = () => {
+    handle.removeEventListener('pointermove', move);
+    handle.removeEventListener('pointerup', end);
+    handle.removeEventListener('pointercancel', end);
+    li.classList.remove('dragging');
+    if (to === from) return;
+    run(api('POST', '/api/queue/move', { from, to }).then(q => {
+      state.queue = q;
+    }).finally(renderQueue));
+  };
+  handle.addEventListener('pointermove', move);
+  handle.addEventListener('pointerup', end);
+  handle.addEventListener('pointercancel', end);
+}
+
+// 加入队列末尾，play为true时立即播放
+function enqueue(ids, play) {
+  return run(api('POST', '/api/queue', { ids }).then(q => {
+    state.queue = q;
+    renderQueue();
+    if (play) return api('POST', '/api/play', { index: q.tracks.length - ids.length });
+  }));
+}
+
+// 用歌单替换队列，从第index首开始播放
+function playList(id, index) {
+  return run(api('POST', '/api/queue', { playlist: id, replace: true })
+    .then(() => api('POST', '/api/play', { index })));
+}
+
+// ---------- 榜单 ----------
+
+function loadCharts() {
+  run(api('GET', '/api/charts').then(charts => {
+    const list = $('#charts');
+    list.replaceChildren();
+    for (const c of charts) {
+      const li = el('li');
+      const info = el('div', 'info');
+      info.append(el('div', 'name', c.name));
+      li.append(info);
+      li.addEventListener('click', () => openChart(c.id, c.name));
+      list.append(li);
+    }
+  }));
+}
+
+function openChart(id, name) {
+  state.chart = { id, name };
+  $('#chart-name').textContent = name;
+  $('#charts-view').hidden = true;
+  $('#chart-view').hidden = false;
+  const list = $('#chart-tracks');
+  list.replaceChildren(el('li', 'empty', '加载中…'));
+  run(api('GET', '/api/charts/' + encodeURIComponent(id)).then(res => {
+    if (!state.chart || state.chart.id !== id) return;
+    state.chart.id = res.id;
+    list.replaceChildren();
+    res.tracks.forEach((track, i) => {
+      const li = trackItem(track, i + 1);
+      if (track.id) li.append(iconButton('+', '加入队列', () => enqueue([track.id], false)));
+      li.addEventListener('click', () => playList(res.id, i));
+      list.append(li);
+    });
+    if (res.tracks.length === 0) list.append(el('li', 'empty', '没有歌曲'));
+  }).catch(err => {
+    list.replaceChildren(el('li', 'empty', '加载失败: ' + err.message));
+    throw err;
+  }));
+}
+
+function closeChart() {
+  state.chart = null;
+  $('#chart-view').hidden = true;
+  $('#charts-view').hidden = false;
+}
+
+// ---------- 搜索 ----------
+
+function search(page) {
+  const s = state.search;
+  if (!s.q) return;
+  const list = $('#search-results');
+  if (page === 1) list.replaceChildren(el('li', 'empty', '搜索中…'));
+  const query = new URLSearchParams({ q: s.q, type: s.type, page });
+  run(api('GET', '/api/search?' + query).then(res => {
+    if (page === 1) list.replaceChildren();
+    s.page = res.page;
+    s.pages = res.pages;
+    for (const track of res.tracks || []) {
+      const li = trackItem(track);
+      li.append(iconButton('+', '加入队列', () => enqueue([track.id], false)));
+      li.addEventListener('click', () => enqueue([track.id], true));
+      list.append(li);
+    }
+    for (const item of res.items || []) {
+      const li = el('li');
+      const info = el('div', 'info');
+      info.append(el('div', 'name', item.name));
+      info.append(el('div', 'sub', [item.owner, item.size ? item.size + '首' : ''].filter(Boolean).join(' · ') || ' '));
+      li.append(info);
+      if (res.type === 'playlist') {
+        li.addEventListener('click', () => {
+          showTab('charts');
+          openChart(item.id, item.name);
+        });
+      }
+      list.append(li);
+    }
+    if (list.children.length === 0) list.append(el('li', 'empty', '没有结果'));
+    $('#search-more').hidden = s.page >= s.pages;
+  }).catch(err => {
+    if (page === 1) list.replaceChildren(el('li', 'empty', '搜索失败: ' + err.message));
+    throw err;
+  }));
+}
+
+// ---------- 页签 ----------
+
+function showTab(name) {
+  for (const b of document.querySelectorAll('#tabs button')) {
+    b.classList.toggle('active', b.dataset.tab === name);
+  }
+  for (const t of document.querySelectorAll('.tab')) {
+    t.classList.toggle('active', t.id === 'tab-' + name);
+  }
+  if (name === 'charts' && $('#charts').children.length === 0) loadCharts();
+}
+
+// ---------- 初始化 ----------
+
+function bind() {
+  $('#toggle').addEventListener('click', () => run(api('POST', '/api/toggle')));
+  $('#prev').addEventListener('click', () => run(api('POST', '/api/prev')));
+  $('#next').addEventListener('click', () => run(api('POST', '/api/next')));
+  $('#mode').addEventListener('click', () => {
+    run(api('PUT', '/api/mode', { mode: (state.status.mode + 1) % MODES.length }).then(st => {
+      state.status = st;
+      renderControls();
+    }));
+  });
+  $('#volume').addEventListener('change', e => run(api('PUT', '/api/volume', { volume: Number(e.target.value) })));
+
+  const seek = $('#seek');
+  seek.addEventListener('input', () => {
+    state.seeking = true;
+    $('#pos').textContent = fmtTime(Number(seek.value));
+  });
+  seek.addEventListener('change', () => {
+    state.seeking = false;
+    run(api('POST', '/api/seek', { position: Number(seek.value) }).then(st => {
+      state.status = st;
+      renderProgress();
+    }));
+  });
+
+  $('#cover').addEventListener('error', e => { e.target.hidden = true; });
+  $('#queue-clear').addEventListener('click', () => {
+    if (confirm('清空播放队列？')) run(api('DELETE', '/api/queue'));
+  });
+  $('#chart-back').addEventListener('click', closeChart);
+  $('#chart-play').addEventListener('click', () => state.chart && playList(state.chart.id, 0));
+
+  $('#search-form').addEventListener('submit', e => {
+    e.preventDefault();
+    state.search.q = $('#search-q').value.trim();
+    state.search.type = $('#search-type').value;
+    search(1);
+  });
+  $('#search-more').addEventListener('click', () => search(state.search.page + 1));
+
+  for (const b of document.querySelectorAll('#tabs button')) {
+    b.addEventListener('click', () => showTab(b.dataset.tab));
+  }
+}
+
+bind();
+connect();
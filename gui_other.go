@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "wander/tui"
+
+// 窗口界面仅支持Windows，其他平台使用终端界面
+func runGUI(target string) {
+	tui.Run(target)
+}
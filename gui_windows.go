@@ -0,0 +1,7 @@
+package main
+
+import "wander/ui"
+
+func runGUI(target string) {
+	ui.Run(target)
+}
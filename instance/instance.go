@@ -0,0 +1,335 @@
+package instance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+	"wander/model"
+)
+
+// 单实例：播放的进程持有锁文件，锁文件中记录本地socket地址，
+// 之后启动的进程把命令转发给它后退出，避免多个进程同时播放
+
+const lockFile = "wander.lock"
+
+const (
+	dialTimeout    = time.Second
+	requestTimeout = 2 * time.Minute // play可能需要下载歌曲
+)
+
+var (
+	ErrRunning    = errors.New("wander is already running")
+	ErrNotRunning = errors.New("no running instance")
+)
+
+// 可转发的命令
+const (
+	CmdPlay   = "play"
+	CmdNext   = "next"
+	CmdPrev   = "prev"
+	CmdToggle = "toggle"
+	CmdPause  = "pause"
+	CmdStop   = "stop"
+	CmdShow   = "show" // 显示窗口，再次启动界面时发送
+	cmdPing   = "ping"
+)
+
+// 由持有锁的界面或服务实现，方法在处理请求的goroutine中调用
+type Controller interface {
+	Play(target string) error // 歌曲ID、本地文件或播放列表文件
+	Next() error
+	Prev() error
+	Toggle() error
+	Pause() error
+	Stop() error
+}
+
+// 有窗口的界面实现，收到show时显示窗口
+type Shower interface {
+	Show()
+}
+
+// 转发的命令在运行的实例中执行失败
+type RemoteError struct {
+	Msg  string
+	Code int // 退出码
+}
+
+func (e *RemoteError) Error() string { return e.Msg }
+
+// 错误对应的退出码，由命令行设置
+var ExitCode = func(err error) int { return 1 }
+
+type lockInfo struct {
+	Pid   int    `json:"pid"`
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+type request struct {
+	Token string   `json:"token"`
+	Args  []string `json:"args"`
+}
+
+type response struct {
+	Error string `json:"error,omitempty"`
+	Code  int    `json:"code,omitempty"`
+}
+
+type Instance struct {
+	path string
+	info lockInfo
+	l    net.Listener
+}
+
+// 数据目录是相对路径，“打开方式”启动时工作目录不同，锁文件放在用户缓存目录
+func lockPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(model.DataDir, lockFile)
+	}
+	return filepath.Join(dir, "wander", lockFile)
+}
+
+// 获取单实例锁，已有实例运行时返回ErrRunning
+// 先监听再写锁文件，Serve之前到达的请求会在连接队列中等待
+func Acquire() (*Instance, error) {
+	path := lockPath()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomToken()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	inst := &Instance{
+		path: path,
+		info: lockInfo{Pid: os.Getpid(), Addr: l.Addr().String(), Token: token},
+		l:    l,
+	}
+	data, _ := json.Marshal(inst.info)
+
+	// 锁文件残留但实例已退出时清理后重试一次
+	var (
+		info  lockInfo
+		stale []byte
+	)
+	for i := 0; i < 2; i++ {
+		err = writeLock(inst.path, data)
+		if err == nil {
+			return inst, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+		info, stale, err = readLockFile(inst.path)
+		if err == nil && send(info, []string{cmdPing}) == nil {
+			l.Close()
+			return nil, ErrRunning
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			// 已被其他进程清理
+			continue
+		}
+		log.Debug("remove stale lock", inst.path)
+		if err = removeStale(inst.path, stale, token); err != nil {
+			break
+		}
+	}
+	l.Close()
+	if errors.Is(err, os.ErrExist) {
+		return nil, ErrRunning
+	}
+	return nil, err
+}
+
+func writeLock(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// 两个进程可能同时判断锁文件残留，先把锁文件移走，确认移走的仍是判断时读到的内容再删除，
+// 否则是另一个进程清理后刚写入的锁文件，放回原处
+func removeStale(path string, stale []byte, token string) error {
+	tmp := path + ".stale-" + token
+	if err := os.Rename(path, tmp); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := ioutil.ReadFile(tmp)
+	if err == nil && bytes.Equal(data, stale) {
+		return os.Remove(tmp)
+	}
+	// 使用Link放回，不会覆盖在此期间新建的锁文件
+	if err = os.Link(tmp, path); err != nil {
+		log.Error("restore lock err:", err)
+		return ErrRunning
+	}
+	os.Remove(tmp)
+	return ErrRunning
+}
+
+// 读取锁文件，刚创建的锁文件可能还没写入内容，稍等后重试
+func readLock() (lockInfo, error) {
+	info, _, err := readLockFile(lockPath())
+	return info, err
+}
+
+// 同时返回锁文件的原始内容
+func readLockFile(path string) (lockInfo, []byte, error) {
+	var info lockInfo
+	for i := 0; ; i++ {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return info, nil, err
+		}
+		if err = json.Unmarshal(data, &info); err == nil || i >= 10 {
+			return info, data, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 处理转发的命令，直到Release
+func (i *Instance) Serve(c Controller) {
+	for {
+		conn, err := i.l.Accept()
+		if err != nil {
+			return
+		}
+		go i.handle(conn, c)
+	}
+}
+
+func (i *Instance) handle(conn net.Conn, c Controller) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		log.Error("instance read request err:", err)
+		return
+	}
+	var resp response
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(i.info.Token)) != 1 {
+		resp = response{Error: "unauthorized", Code: 1}
+	} else if err := dispatch(c, req.Args); err != nil {
+		resp = response{Error: err.Error(), Code: ExitCode(err)}
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Error("instance write response err:", err)
+	}
+}
+
+func dispatch(c Controller, args []string) error {
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+	switch args[0] {
+	case cmdPing:
+		return nil
+	case CmdPlay:
+		if len(args) != 2 {
+			return fmt.Errorf("play: expect 1 argument, got %d", len(args)-1)
+		}
+		return c.Play(args[1])
+	case CmdNext:
+		return c.Next()
+	case CmdPrev:
+		return c.Prev()
+	case CmdToggle:
+		return c.Toggle()
+	case CmdPause:
+		return c.Pause()
+	case CmdStop:
+		return c.Stop()
+	case CmdShow:
+		if s, ok := c.(Shower); ok {
+			s.Show()
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+// 停止接收命令并删除锁文件
+func (i *Instance) Release() {
+	i.l.Close()
+	// 锁文件已被其他实例接管时不删除
+	if info, err := readLock(); err == nil && info.Token == i.info.Token {
+		if err = os.Remove(i.path); err != nil {
+			log.Error("remove lock err:", err)
+		}
+	}
+}
+
+// 把命令转发给正在运行的实例，没有实例运行时返回ErrNotRunning
+func Forward(args ...string) error {
+	info, err := readLock()
+	if err != nil {
+		return ErrNotRunning
+	}
+	// 两个进程的工作目录可能不同，本地文件使用绝对路径
+	if len(args) == 2 && args[0] == CmdPlay {
+		if _, err := os.Stat(args[1]); err == nil {
+			if abs, err := filepath.Abs(args[1]); err == nil {
+				args = []string{CmdPlay, abs}
+			}
+		}
+	}
+	return send(info, args)
+}
+
+func send(info lockInfo, args []string) error {
+	conn, err := net.DialTimeout("tcp", info.Addr, dialTimeout)
+	if err != nil {
+		return ErrNotRunning
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+	if err = json.NewEncoder(conn).Encode(request{Token: info.Token, Args: args}); err != nil {
+		return err
+	}
+	var resp response
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return &RemoteError{Msg: resp.Error, Code: resp.Code}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package instance
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFile)
+	stale := []byte(`{"pid":1,"addr":"127.0.0.1:1","token":"old"}`)
+	if err := ioutil.WriteFile(path, stale, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStale(path, stale, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale lock not removed: %v", err)
+	}
+	// 已被其他进程清理
+	if err := removeStale(path, stale, "b"); err != nil {
+		t.Errorf("remove missing lock = %v", err)
+	}
+
+	// 另一个进程清理后写入了新的锁文件，不能删除
+	fresh := []byte(`{"pid":2,"addr":"127.0.0.1:2","token":"new"}`)
+	if err := ioutil.WriteFile(path, fresh, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStale(path, stale, "c"); !errors.Is(err, ErrRunning) {
+		t.Errorf("remove fresh lock = %v, want ErrRunning", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != string(fresh) {
+		t.Errorf("lock = %q, %v, want the fresh lock", data, err)
+	}
+	if matches, _ := filepath.Glob(path + ".stale-*"); len(matches) != 0 {
+		t.Errorf("left %v", matches)
+	}
+}
+
+func TestAcquireStaleLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(lockPath()), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// 已退出的实例留下的锁文件
+	if err := ioutil.WriteFile(lockPath(), []byte(`{"pid":1,"addr":"127.0.0.1:1","token":"old"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	inst, err := Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go inst.Serve(nil)
+	if _, err = Acquire(); !errors.Is(err, ErrRunning) {
+		t.Errorf("second Acquire = %v, want ErrRunning", err)
+	}
+	inst.Release()
+	if _, err = os.Stat(lockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock not removed after Release: %v", err)
+	}
+}
@@ -1,11 +1,48 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/lauthrul/goutil/log"
-	"wander/ui"
+	"os"
+	"wander/cli"
+	"wander/instance"
+	"wander/tui"
 )
 
 func main() {
 	log.Init("")
-	ui.Run()
+
+	// 子命令以命令行方式运行，不启动界面
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	useTui := flag.Bool("tui", false, "使用终端界面")
+	flag.Parse()
+
+	// 参数为歌曲ID或文件，便于“打开方式”关联；已有实例运行时交给它处理后退出
+	target := flag.Arg(0)
+	args := []string{instance.CmdShow}
+	if target != "" {
+		args = []string{instance.CmdPlay, target}
+	}
+	if err := instance.Forward(args...); !errors.Is(err, instance.ErrNotRunning) {
+		if err != nil {
+			log.Error("forward err:", err)
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(cli.ExitCode(err))
+		}
+		if *useTui && target == "" {
+			fmt.Println(instance.ErrRunning)
+		}
+		return
+	}
+
+	if *useTui {
+		tui.Run(target)
+		return
+	}
+	runGUI(target)
 }
@@ -10,19 +10,31 @@ const (
 	// id=2250011882，抖音排行榜
 	Playlist = "https://music.163.com/api/playlist/detail?id=%s"
 
+	// 歌曲详情，ids=[id1,id2,...]
+	SongDetail = "https://music.163.com/api/song/detail/?ids=%s"
+
 	// 评论
-	Comment = "http://music.163.com/api/v1/resource/comments/R_SO_4_{歌曲ID}?limit=20&offset=0"
+	Comment    = "http://music.163.com/api/v1/resource/comments/R_SO_4_%s?limit=%d&offset=%d"
+	HotComment = "http://music.163.com/api/v1/resource/hotcomments/R_SO_4_%s?limit=%d&offset=%d"
 
 	// 歌词
-	Lyrics = "https://music.163.com/api/song/lyric?id={歌曲ID}&lv=1&kv=1&tv=-1"
+	Lyrics = "https://music.163.com/api/song/lyric?id=%s&lv=1&kv=1&tv=-1"
 
 	// 随机歌曲
 	RandomUrl  = "https://api.66mz8.com/api/rand.music.163.php?format=json"
 	RandomUrl2 = "https://api.66mz8.com/api/music.163.php?format=json"
 
 	// 歌曲搜索
-	SearchUrl = "https://v1.alapi.cn/api/music/search?keyword=我爱你"
+	// type=1，单曲；type=10，专辑；type=100，歌手；type=1000，歌单
+	SearchUrl = "https://v1.alapi.cn/api/music/search?keyword=%s&type=%d&limit=%d&offset=%d"
+
+	// 歌曲外链
+	OuterUrl = "http://music.163.com/song/media/outer/url?id=%s.mp3"
 
 	// 歌曲真实地址
 	LinkUrl = "https://v1.alapi.cn/api/music/url?format=json&id=%s"
+
+	// 音乐记录（scrobble）服务，可在配置中替换
+	ListenBrainzUrl = "https://api.listenbrainz.org"
+	LastFmUrl       = "https://ws.audioscrobbler.com/2.0/"
 )
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const blocklistFile = "blocklist.json"
+
+type BlockKind string
+
+const (
+	BlockTrack  BlockKind = "track"
+	BlockArtist BlockKind = "artist"
+)
+
+type BlockEntry struct {
+	Kind  BlockKind `json:"kind"`
+	Key   string    `json:"key"`  // 歌曲ID或歌手名
+	Name  string    `json:"name"` // 显示名称
+	Added time.Time `json:"added"`
+}
+
+type blockOp struct {
+	block bool // true为屏蔽操作，false为取消屏蔽
+	entry BlockEntry
+}
+
+// 屏蔽列表，屏蔽与取消屏蔽均可撤销
+type Blocklist struct {
+	mu      sync.Mutex
+	entries []BlockEntry
+	undo    []blockOp
+}
+
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+func NewBlocklist() (*Blocklist, error) {
+	b := &Blocklist{}
+	err := loadStore(blocklistFile, &b.entries)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return b, err
+}
+
+func (b *Blocklist) save() error {
+	return saveJson(blocklistFile, b.entries)
+}
+
+func (b *Blocklist) find(kind BlockKind, key string) int {
+	for i, e := range b.entries {
+		if e.Kind == kind && e.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Blocklist) add(entry BlockEntry) bool {
+	if b.find(entry.Kind, entry.Key) >= 0 {
+		return false
+	}
+	b.entries = append(b.entries, entry)
+	return true
+}
+
+func (b *Blocklist) remove(kind BlockKind, key string) (BlockEntry, bool) {
+	i := b.find(kind, key)
+	if i < 0 {
+		return BlockEntry{}, false
+	}
+	entry := b.entries[i]
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	return entry, true
+}
+
+func (b *Blocklist) Block(kind BlockKind, key, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := BlockEntry{Kind: kind, Key: key, Name: name, Added: time.Now()}
+	if !b.add(entry) {
+		return nil
+	}
+	b.undo = append(b.undo, blockOp{block: true, entry: entry})
+	return b.save()
+}
+
+func (b *Blocklist) BlockTrack(info MusicInfo) error {
+	return b.Block(BlockTrack, info.ID, info.Name+" - "+info.ArtistsName)
+}
+
+// 屏蔽歌手，多个歌手时屏蔽第一个
+func (b *Blocklist) BlockArtist(name string) error {
+	name = strings.TrimSpace(strings.Split(name, ",")[0])
+	return b.Block(BlockArtist, name, name)
+}
+
+func (b *Blocklist) Unblock(kind BlockKind, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.remove(kind, key)
+	if !ok {
+		return nil
+	}
+	b.undo = append(b.undo, blockOp{block: false, entry: entry})
+	return b.save()
+}
+
+// 撤销最近一次屏蔽或取消屏蔽
+func (b *Blocklist) Undo() (BlockEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.undo) == 0 {
+		return BlockEntry{}, ErrNothingToUndo
+	}
+	op := b.undo[len(b.undo)-1]
+	b.undo = b.undo[:len(b.undo)-1]
+	if op.block {
+		b.remove(op.entry.Kind, op.entry.Key)
+	} else {
+		b.add(op.entry)
+	}
+	return op.entry, b.save()
+}
+
+// 已屏蔽的列表
+func (b *Blocklist) Entries() []BlockEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BlockEntry(nil), b.entries...)
+}
+
+func (b *Blocklist) IsBlocked(info MusicInfo) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range b.entries {
+		switch e.Kind {
+		case BlockTrack:
+			if e.Key == info.ID {
+				return true
+			}
+		case BlockArtist:
+			for _, a := range strings.Split(info.ArtistsName, ",") {
+				if strings.TrimSpace(a) == e.Key {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type RankChange string
+
+const (
+	RankNew     RankChange = "new"
+	RankUp      RankChange = "up"
+	RankDown    RankChange = "down"
+	RankSame    RankChange = "same"
+	RankDropped RankChange = "dropped"
+)
+
+type ChartEntry struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ArtistsName string `json:"artists_name"`
+}
+
+// 某次获取时榜单的歌曲顺序
+type ChartSnapshot struct {
+	Time      time.Time    `json:"time"`
+	Tracks    []ChartEntry `json:"tracks"`
+	Unchanged bool         `json:"unchanged,omitempty"` // 与上次顺序相同，文件中不保存Tracks
+}
+
+type RankMovement struct {
+	ChartEntry
+	Rank     int        `json:"rank"`      // 当前排名，从1开始，跌出榜单时为0
+	PrevRank int        `json:"prev_rank"` // 上次排名，新上榜时为0
+	Delta    int        `json:"delta"`     // 上升为正，下降为负
+	Change   RankChange `json:"change"`
+}
+
+type RankPoint struct {
+	Time time.Time `json:"time"`
+	Rank int       `json:"rank"` // 不在榜单时为0
+}
+
+func chartHistoryFile(id string) string {
+	return dataPath(fmt.Sprintf("%s/%s.history.jsonl", chartSnapshotDir, id))
+}
+
+func (s *ChartSnapshot) sameOrder(musics []*Music) bool {
+	if len(s.Tracks) != len(musics) {
+		return false
+	}
+	for i, m := range musics {
+		if s.Tracks[i].ID != m.Info.ID {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ChartSnapshot) sameTracks(o *ChartSnapshot) bool {
+	if len(s.Tracks) != len(o.Tracks) {
+		return false
+	}
+	for i, t := range o.Tracks {
+		if s.Tracks[i].ID != t.ID {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ChartSnapshot) ranks() map[string]int {
+	ranks := map[string]int{}
+	for i, t := range s.Tracks {
+		ranks[t.ID] = i + 1
+	}
+	return ranks
+}
+
+// 历史快照，按时间先后排列
+func ChartSnapshots(id string) ([]ChartSnapshot, error) {
+	f, err := os.Open(chartHistoryFile(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshots []ChartSnapshot
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var s ChartSnapshot
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		if n := len(snapshots); s.Unchanged && n > 0 {
+			s.Tracks = snapshots[n-1].Tracks
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, scanner.Err()
+}
+
+// 记录一次榜单顺序，与上次相同时只记录时间
+func RecordChartSnapshot(id string, musics []*Music) error {
+	snapshots, err := ChartSnapshots(id)
+	if err != nil {
+		return err
+	}
+
+	s := ChartSnapshot{Time: time.Now()}
+	if n := len(snapshots); n > 0 && snapshots[n-1].sameOrder(musics) {
+		s.Unchanged = true
+	} else {
+		for _, m := range musics {
+			s.Tracks = append(s.Tracks, ChartEntry{ID: m.Info.ID, Name: m.Info.Name, ArtistsName: m.Info.ArtistsName})
+		}
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dataPath(chartSnapshotDir), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(chartHistoryFile(id), os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// 与上一次不同顺序的快照比较排名变化，跌出榜单的歌曲排在最后
+func ChartMovements(id string) ([]RankMovement, error) {
+	snapshots, err := ChartSnapshots(id)
+	if err != nil {
+		return nil, err
+	}
+	n := len(snapshots)
+	if n == 0 {
+		return nil, nil
+	}
+	cur := snapshots[n-1]
+	// 顺序未变的获取只记录时间，跳过
+	var last *ChartSnapshot
+	for i := n - 2; i >= 0; i-- {
+		if !snapshots[i].sameTracks(&cur) {
+			last = &snapshots[i]
+			break
+		}
+	}
+	var prev map[string]int
+	if last != nil {
+		prev = last.ranks()
+	}
+
+	var movements []RankMovement
+	for i, t := range cur.Tracks {
+		m := RankMovement{ChartEntry: t, Rank: i + 1, PrevRank: prev[t.ID]}
+		switch {
+		case prev == nil:
+			m.Change = RankSame
+		case m.PrevRank == 0:
+			m.Change = RankNew
+		case m.PrevRank > m.Rank:
+			m.Change = RankUp
+		case m.PrevRank < m.Rank:
+			m.Change = RankDown
+		default:
+			m.Change = RankSame
+		}
+		if m.PrevRank > 0 {
+			m.Delta = m.PrevRank - m.Rank
+		}
+		movements = append(movements, m)
+	}
+	if last != nil {
+		ranks := cur.ranks()
+		for i, t := range last.Tracks {
+			if ranks[t.ID] == 0 {
+				movements = append(movements, RankMovement{ChartEntry: t, PrevRank: i + 1, Change: RankDropped})
+			}
+		}
+	}
+	return movements, nil
+}
+
+// 歌曲在榜单中的排名历史
+func TrackRankHistory(chartID, trackID string) ([]RankPoint, error) {
+	snapshots, err := ChartSnapshots(chartID)
+	if err != nil {
+		return nil, err
+	}
+	var points []RankPoint
+	for _, s := range snapshots {
+		points = append(points, RankPoint{Time: s.Time, Rank: s.ranks()[trackID]})
+	}
+	return points, nil
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func chartMusics(ids ...string) []*Music {
+	var musics []*Music
+	for _, id := range ids {
+		musics = append(musics, &Music{Info: MusicInfo{ID: id, Name: id}})
+	}
+	return musics
+}
+
+func TestRecordChartSnapshot(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	for _, ids := range [][]string{{"a", "b", "c"}, {"a", "b", "c"}, {"b", "a", "d"}, {"b", "a", "d"}} {
+		if err := RecordChartSnapshot("1", chartMusics(ids...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 顺序不变时只记录时间
+	data, err := ioutil.ReadFile(chartHistoryFile("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 4 || bytes.Contains(lines[1], []byte(`"id"`)) {
+		t.Errorf("history file:\n%s", data)
+	}
+
+	snapshots, err := ChartSnapshots("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 4 || len(snapshots[1].Tracks) != 3 || snapshots[3].Tracks[0].ID != "b" {
+		t.Fatalf("snapshots = %+v", snapshots)
+	}
+
+	points, err := TrackRankHistory("1", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ranks []int
+	for _, p := range points {
+		ranks = append(ranks, p.Rank)
+	}
+	if len(ranks) != 4 || ranks[0] != 1 || ranks[1] != 1 || ranks[2] != 2 || ranks[3] != 2 {
+		t.Errorf("ranks of a = %v, want [1 1 2 2]", ranks)
+	}
+	if points[3].Time.Before(points[2].Time) {
+		t.Errorf("latest point %v before %v", points[3].Time, points[2].Time)
+	}
+
+	// 最近一次与上次相同时，与顺序不同的那次比较
+	movements, err := ChartMovements("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id     string
+		change RankChange
+		delta  int
+	}{{"b", RankUp, 1}, {"a", RankDown, -1}, {"d", RankNew, 0}, {"c", RankDropped, 0}}
+	if len(movements) != len(want) {
+		t.Fatalf("movements = %+v", movements)
+	}
+	for i, w := range want {
+		if m := movements[i]; m.ID != w.id || m.Change != w.change || m.Delta != w.delta {
+			t.Errorf("movement %d = %s %s %d, want %s %s %d", i, m.ID, m.Change, m.Delta, w.id, w.change, w.delta)
+		}
+	}
+}
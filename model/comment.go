@@ -0,0 +1,172 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const DefaultCommentLimit = 20
+
+// 评论缓存有效期
+var CommentCacheTTL = 5 * time.Minute
+
+// 评论缓存最多保存的页数，超出时先淘汰最早过期的
+const maxCommentCache = 200
+
+type commentUserResp struct {
+	UserID    int    `json:"userId"`
+	Nickname  string `json:"nickname"`
+	AvatarUrl string `json:"avatarUrl"`
+}
+
+type CommentItemResp struct {
+	CommentID  int             `json:"commentId"`
+	User       commentUserResp `json:"user"`
+	Content    string          `json:"content"`
+	LikedCount int             `json:"likedCount"`
+	Time       int64           `json:"time"` // 毫秒
+}
+
+type CommentResp struct {
+	Code        int               `json:"code"`
+	Total       int               `json:"total"`
+	More        bool              `json:"more"`
+	HasMore     bool              `json:"hasMore"`
+	HotComments []CommentItemResp `json:"hotComments"`
+	Comments    []CommentItemResp `json:"comments"`
+}
+
+type CommentInfo struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Nickname   string    `json:"nickname"`
+	AvatarUrl  string    `json:"avatar_url"`
+	Content    string    `json:"content"`
+	LikedCount int       `json:"liked_count"`
+	Time       time.Time `json:"time"`
+}
+
+type CommentPage struct {
+	MusicID string        `json:"music_id"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	Total   int           `json:"total"`
+	More    bool          `json:"more"`
+	Hot     []CommentInfo `json:"hot"`    // 热门评论
+	Latest  []CommentInfo `json:"latest"` // 最新评论
+}
+
+type commentCacheItem struct {
+	page   *CommentPage
+	expire time.Time
+}
+
+var (
+	commentCache   = map[string]commentCacheItem{}
+	commentCacheMu sync.Mutex
+)
+
+func walkComments(items []CommentItemResp) []CommentInfo {
+	var comments []CommentInfo
+	for _, item := range items {
+		comments = append(comments, CommentInfo{
+			ID:         fmt.Sprintf("%d", item.CommentID),
+			UserID:     fmt.Sprintf("%d", item.User.UserID),
+			Nickname:   item.User.Nickname,
+			AvatarUrl:  item.User.AvatarUrl,
+			Content:    item.Content,
+			LikedCount: item.LikedCount,
+			Time:       time.Unix(0, item.Time*int64(time.Millisecond)),
+		})
+	}
+	return comments
+}
+
+func requestComments(tmpl, id string, limit, offset int) (*CommentPage, error) {
+	if limit <= 0 {
+		limit = DefaultCommentLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	uri := fmt.Sprintf(tmpl, id, limit, offset)
+
+	commentCacheMu.Lock()
+	item, ok := commentCache[uri]
+	if ok && !time.Now().Before(item.expire) {
+		delete(commentCache, uri)
+		ok = false
+	}
+	commentCacheMu.Unlock()
+	if ok {
+		return item.page, nil
+	}
+
+	var resp CommentResp
+	data, err := HttpGetJson(uri, &resp, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != 200 {
+		return nil, codeError("comment", resp.Code, data)
+	}
+	page := &CommentPage{
+		MusicID: id,
+		Limit:   limit,
+		Offset:  offset,
+		Total:   resp.Total,
+		More:    resp.More || resp.HasMore,
+		Hot:     walkComments(resp.HotComments),
+		Latest:  walkComments(resp.Comments),
+	}
+
+	commentCacheMu.Lock()
+	now := time.Now()
+	purgeCommentCache(now)
+	for len(commentCache) >= maxCommentCache {
+		evictCommentCache()
+	}
+	commentCache[uri] = commentCacheItem{page: page, expire: now.Add(CommentCacheTTL)}
+	commentCacheMu.Unlock()
+	return page, nil
+}
+
+// 最新评论，offset为0时同时返回热门评论
+func RequestComments(id string, limit, offset int) (*CommentPage, error) {
+	return requestComments(Comment, id, limit, offset)
+}
+
+// 热门评论分页
+func RequestHotComments(id string, limit, offset int) (*CommentPage, error) {
+	return requestComments(HotComment, id, limit, offset)
+}
+
+// 清除过期的评论缓存
+func PurgeCommentCache() {
+	commentCacheMu.Lock()
+	defer commentCacheMu.Unlock()
+	purgeCommentCache(time.Now())
+}
+
+func purgeCommentCache(now time.Time) {
+	for k, v := range commentCache {
+		if !now.Before(v.expire) {
+			delete(commentCache, k)
+		}
+	}
+}
+
+// 淘汰最早过期的一页
+func evictCommentCache() {
+	var (
+		oldest string
+		expire time.Time
+	)
+	for k, v := range commentCache {
+		if oldest == "" || v.expire.Before(expire) {
+			oldest, expire = k, v.expire
+		}
+	}
+	delete(commentCache, oldest)
+}
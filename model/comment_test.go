@@ -0,0 +1,68 @@
+package model
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCommentCacheBounded(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"code":200,"total":1,"comments":[{"commentId":1,"content":"好听"}]}`))
+	}))
+	defer srv.Close()
+	tmpl := srv.URL + "/%s?limit=%d&offset=%d"
+
+	ttl := CommentCacheTTL
+	defer func() {
+		CommentCacheTTL = ttl
+		commentCacheMu.Lock()
+		commentCache = map[string]commentCacheItem{}
+		commentCacheMu.Unlock()
+	}()
+	cacheSize := func() int {
+		commentCacheMu.Lock()
+		defer commentCacheMu.Unlock()
+		return len(commentCache)
+	}
+
+	// 命中缓存时不再请求
+	for i := 0; i < 2; i++ {
+		if page, err := requestComments(tmpl, "1", 0, 0); err != nil || len(page.Latest) != 1 {
+			t.Fatalf("page = %+v, %v", page, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+
+	// 超出上限时淘汰
+	for i := 0; i < maxCommentCache+10; i++ {
+		if _, err := requestComments(tmpl, "1", 1, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := cacheSize(); n != maxCommentCache {
+		t.Errorf("cache size = %d, want %d", n, maxCommentCache)
+	}
+
+	// 过期的在写入时清除
+	commentCacheMu.Lock()
+	commentCache = map[string]commentCacheItem{}
+	commentCacheMu.Unlock()
+	CommentCacheTTL = time.Millisecond
+	if _, err := requestComments(tmpl, "2", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := requestComments(tmpl, "3", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := cacheSize(); n != 1 {
+		t.Errorf("cache size = %d after expiry, want 1", n)
+	}
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分段下载每次请求的大小
+var DownloadChunkSize = 512 * 1024
+
+// 下载进度，Total未知时为0
+type DownloadProgress struct {
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Received int    `json:"received"`
+	Total    int    `json:"total"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
+
+var (
+	downloadMu sync.Mutex
+	onDownload []func(DownloadProgress)
+)
+
+// 下载进度回调，每下载一段及结束时调用
+func OnDownloadProgress(f func(DownloadProgress)) {
+	downloadMu.Lock()
+	defer downloadMu.Unlock()
+	onDownload = append(onDownload, f)
+}
+
+func notifyDownload(p DownloadProgress) {
+	downloadMu.Lock()
+	fs := append([]func(DownloadProgress){}, onDownload...)
+	downloadMu.Unlock()
+	for _, f := range fs {
+		f(p)
+	}
+}
+
+// 按Range分段下载，服务器不支持Range时一次返回全部内容
+func downloadChunks(uri string, p *DownloadProgress) ([]byte, error) {
+	var data []byte
+	for {
+		chunk, total, partial, err := httpGetRange(uri, len(data), DownloadChunkSize, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if !partial {
+			p.Received, p.Total = len(chunk), len(chunk)
+			return chunk, nil
+		}
+		data = append(data, chunk...)
+		p.Received, p.Total = len(data), total
+		if len(chunk) < DownloadChunkSize || total > 0 && len(data) >= total {
+			return data, nil
+		}
+		notifyDownload(*p)
+	}
+}
+
+// 请求[start, start+size)范围的内容，返回内容、资源总大小以及是否为部分内容
+func httpGetRange(uri string, start, size int, timeout time.Duration) ([]byte, int, bool, error) {
+	if IsOffline() {
+		return nil, 0, false, &NetworkError{ErrOffline}
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseResponse(resp)
+		fasthttp.ReleaseRequest(req)
+	}()
+
+	req.SetRequestURI(uri)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+size-1))
+	err := fc.DoTimeout(req, resp, timeout)
+	log.DebugF("%s [%d-] -> [%d] %v\n", uri, start, resp.StatusCode(), err)
+	if err != nil {
+		probeNetwork()
+		return nil, 0, false, &NetworkError{err}
+	}
+
+	data := append([]byte(nil), resp.Body()...)
+	switch code := resp.StatusCode(); code {
+	case fasthttp.StatusOK:
+		return data, len(data), false, nil
+	case fasthttp.StatusPartialContent:
+		// Content-Range: bytes 0-524287/3456789
+		total := 0
+		cr := string(resp.Header.Peek(fasthttp.HeaderContentRange))
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			total, _ = strconv.Atoi(cr[i+1:])
+		}
+		return data, total, true, nil
+	case fasthttp.StatusNotFound:
+		return nil, 0, false, fmt.Errorf("http status err[%d]: %w", code, ErrNotFound)
+	default:
+		return nil, 0, false, &NetworkError{fmt.Errorf("http status err[%d]", code)}
+	}
+}
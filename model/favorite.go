@@ -0,0 +1,202 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	favoriteStoreFile = "favorites.json"
+	MaxRating         = 5
+)
+
+var (
+	ErrRating  = fmt.Errorf("rating must be between 0 and %d", MaxRating)
+	ErrNoTrack = errors.New("local track without id cannot be favorited or rated")
+)
+
+// 用户对歌曲的收藏与评分
+type UserTrack struct {
+	Provider string    `json:"provider"`
+	ID       string    `json:"id"`
+	Info     MusicInfo `json:"info"`
+	Favorite bool      `json:"favorite"`
+	Rating   int       `json:"rating"` // 0表示未评分
+	Added    time.Time `json:"added"`  // 收藏时间
+	Updated  time.Time `json:"updated"`
+}
+
+type FavoriteStore struct {
+	mu     sync.Mutex
+	tracks map[string]*UserTrack
+}
+
+// 以provider+歌曲ID为键，不受榜单刷新影响
+func trackKey(id string) string {
+	return ProviderNetease + ":" + id
+}
+
+func NewFavoriteStore() (*FavoriteStore, error) {
+	f := &FavoriteStore{tracks: map[string]*UserTrack{}}
+	var tracks []*UserTrack
+	err := loadStore(favoriteStoreFile, &tracks)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	for _, t := range tracks {
+		f.tracks[t.Provider+":"+t.ID] = t
+	}
+	return f, err
+}
+
+func (f *FavoriteStore) save() error {
+	var tracks []*UserTrack
+	for _, t := range f.tracks {
+		tracks = append(tracks, t)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].Added.Before(tracks[j].Added)
+	})
+	return saveJson(favoriteStoreFile, tracks)
+}
+
+func (f *FavoriteStore) track(info MusicInfo) *UserTrack {
+	key := trackKey(info.ID)
+	t := f.tracks[key]
+	if t == nil {
+		t = &UserTrack{Provider: ProviderNetease, ID: info.ID}
+		f.tracks[key] = t
+	}
+	// 只保存歌曲元数据，本地缓存路径可能失效
+	info.MusicLocal, info.MusicPicLocal, info.LyricLocal = "", "", ""
+	t.Info = info
+	t.Updated = time.Now()
+	return t
+}
+
+// 没有收藏也没有评分的记录不再保留
+func (f *FavoriteStore) prune(t *UserTrack) {
+	if !t.Favorite && t.Rating == 0 {
+		delete(f.tracks, t.Provider+":"+t.ID)
+	}
+}
+
+// 本地歌曲没有ID，无法收藏
+func (f *FavoriteStore) SetFavorite(info MusicInfo, favorite bool) error {
+	if info.ID == "" {
+		return ErrNoTrack
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := f.track(info)
+	if favorite && !t.Favorite {
+		t.Added = time.Now()
+	}
+	t.Favorite = favorite
+	f.prune(t)
+	return f.save()
+}
+
+func (f *FavoriteStore) ToggleFavorite(info MusicInfo) (bool, error) {
+	favorite := !f.IsFavorite(info.ID)
+	return favorite, f.SetFavorite(info, favorite)
+}
+
+func (f *FavoriteStore) IsFavorite(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := f.tracks[trackKey(id)]
+	return t != nil && t.Favorite
+}
+
+// 评分1-5星，0表示清除评分
+func (f *FavoriteStore) SetRating(info MusicInfo, rating int) error {
+	if rating < 0 || rating > MaxRating {
+		return ErrRating
+	}
+	if info.ID == "" {
+		return ErrNoTrack
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := f.track(info)
+	t.Rating = rating
+	f.prune(t)
+	return f.save()
+}
+
+func (f *FavoriteStore) Rating(id string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t := f.tracks[trackKey(id)]; t != nil {
+		return t.Rating
+	}
+	return 0
+}
+
+// 收藏的歌曲，按收藏时间排序
+func (f *FavoriteStore) Favorites() []MusicInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tracks []*UserTrack
+	for _, t := range f.tracks {
+		if t.Favorite {
+			tracks = append(tracks, t)
+		}
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].Added.Before(tracks[j].Added)
+	})
+	var infos []MusicInfo
+	for _, t := range tracks {
+		infos = append(infos, t.Info)
+	}
+	return infos
+}
+
+type RatingExport struct {
+	Provider    string    `json:"provider"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ArtistsName string    `json:"artists_name"`
+	Rating      int       `json:"rating"`
+	Favorite    bool      `json:"favorite"`
+	Updated     time.Time `json:"updated"`
+}
+
+// 导出评分为json
+func (f *FavoriteStore) ExportRatings(w io.Writer) error {
+	f.mu.Lock()
+	var ratings []RatingExport
+	for _, t := range f.tracks {
+		if t.Rating == 0 {
+			continue
+		}
+		ratings = append(ratings, RatingExport{
+			Provider:    t.Provider,
+			ID:          t.ID,
+			Name:        t.Info.Name,
+			ArtistsName: t.Info.ArtistsName,
+			Rating:      t.Rating,
+			Favorite:    t.Favorite,
+			Updated:     t.Updated,
+		})
+	}
+	f.mu.Unlock()
+
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Rating != ratings[j].Rating {
+			return ratings[i].Rating > ratings[j].Rating
+		}
+		return ratings[i].Updated.After(ratings[j].Updated)
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ratings)
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFavoriteLocalTrack(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	f, err := NewFavoriteStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := MusicInfo{Name: "a", MusicLocal: "/music/a.mp3"}
+	if _, err = f.ToggleFavorite(local); !errors.Is(err, ErrNoTrack) {
+		t.Errorf("ToggleFavorite = %v, want ErrNoTrack", err)
+	}
+	if err = f.SetRating(local, 4); !errors.Is(err, ErrNoTrack) {
+		t.Errorf("SetRating = %v, want ErrNoTrack", err)
+	}
+	if len(f.Favorites()) != 0 {
+		t.Errorf("favorites = %v", f.Favorites())
+	}
+
+	if _, err = f.ToggleFavorite(MusicInfo{ID: "1", Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.IsFavorite("1") || f.IsFavorite("") {
+		t.Error("favorite by id")
+	}
+}
@@ -0,0 +1,330 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyFile = "history.jsonl"
+
+// 计为一次播放的阈值：收听达到时长的Percent，或达到Max
+type PlayThreshold struct {
+	Percent float64
+	Max     time.Duration
+}
+
+var DefaultPlayThreshold = PlayThreshold{Percent: 0.5, Max: 4 * time.Minute}
+
+func (t PlayThreshold) Reached(listened, duration time.Duration) bool {
+	if t.Max > 0 && listened >= t.Max {
+		return true
+	}
+	return duration > 0 && t.Percent > 0 && float64(listened) >= float64(duration)*t.Percent
+}
+
+type PlayRecord struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	ArtistsName string        `json:"artists_name"`
+	Source      string        `json:"source"` // 来源歌单ID
+	Start       time.Time     `json:"start"`
+	Listened    time.Duration `json:"listened"`
+	Duration    time.Duration `json:"duration"`
+	Skipped     bool          `json:"skipped"`
+	Counted     bool          `json:"counted"` // 是否计为一次播放
+}
+
+type TrackStat struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	ArtistsName string        `json:"artists_name"`
+	Count       int           `json:"count"`
+	Listened    time.Duration `json:"listened"`
+}
+
+type ArtistStat struct {
+	Name     string        `json:"name"`
+	Count    int           `json:"count"`
+	Listened time.Duration `json:"listened"`
+}
+
+type HistorySummary struct {
+	TotalPlays    int           `json:"total_plays"`
+	TotalListened time.Duration `json:"total_listened"`
+	CurrentStreak int           `json:"current_streak"` // 连续收听天数
+	LongestStreak int           `json:"longest_streak"`
+}
+
+// 播放历史，以json lines追加保存
+type History struct {
+	Threshold PlayThreshold
+
+	mu      sync.Mutex
+	records []PlayRecord
+}
+
+func NewHistory() (*History, error) {
+	h := &History{Threshold: DefaultPlayThreshold}
+	f, err := os.Open(dataPath(historyFile))
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec PlayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// 跳过损坏的行
+			continue
+		}
+		h.records = append(h.records, rec)
+	}
+	return h, scanner.Err()
+}
+
+func (h *History) Record(rec PlayRecord) (PlayRecord, error) {
+	rec.Counted = h.Threshold.Reached(rec.Listened, rec.Duration)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, rec)
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	if err = os.MkdirAll(DataDir, os.ModePerm); err != nil {
+		return rec, err
+	}
+	f, err := os.OpenFile(dataPath(historyFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return rec, err
+}
+
+// 时间范围内的记录，零值表示不限
+func (h *History) Records(since, until time.Time) []PlayRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var records []PlayRecord
+	for _, r := range h.records {
+		if !since.IsZero() && r.Start.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !r.Start.Before(until) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// 最近n条记录，最新的在前
+func (h *History) Recent(n int) []PlayRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var records []PlayRecord
+	for i := len(h.records) - 1; i >= 0 && len(records) < n; i-- {
+		records = append(records, h.records[i])
+	}
+	return records
+}
+
+func (h *History) PlayCount(id string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	count := 0
+	for _, r := range h.records {
+		if r.ID == id && r.Counted {
+			count++
+		}
+	}
+	return count
+}
+
+// 每首歌在limit内被跳过的次数
+func (h *History) EarlySkips(limit time.Duration) map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	skips := map[string]int{}
+	for _, r := range h.records {
+		if r.Skipped && r.Listened < limit {
+			skips[r.ID]++
+		}
+	}
+	return skips
+}
+
+func (h *History) TopTracks(since, until time.Time, n int) []TrackStat {
+	stats := map[string]*TrackStat{}
+	for _, r := range h.Records(since, until) {
+		if !r.Counted {
+			continue
+		}
+		s := stats[r.ID]
+		if s == nil {
+			s = &TrackStat{ID: r.ID, Name: r.Name, ArtistsName: r.ArtistsName}
+			stats[r.ID] = s
+		}
+		s.Count++
+		s.Listened += r.Listened
+	}
+	var list []TrackStat
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Listened > list[j].Listened
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (h *History) TopArtists(since, until time.Time, n int) []ArtistStat {
+	stats := map[string]*ArtistStat{}
+	for _, r := range h.Records(since, until) {
+		if !r.Counted {
+			continue
+		}
+		for _, name := range strings.Split(r.ArtistsName, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			s := stats[name]
+			if s == nil {
+				s = &ArtistStat{Name: name}
+				stats[name] = s
+			}
+			s.Count++
+			s.Listened += r.Listened
+		}
+	}
+	var list []ArtistStat
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+func (h *History) Summary() HistorySummary {
+	var (
+		summary HistorySummary
+		days    = map[string]bool{}
+	)
+	for _, r := range h.Records(time.Time{}, time.Time{}) {
+		summary.TotalListened += r.Listened
+		if r.Counted {
+			summary.TotalPlays++
+			days[r.Start.Local().Format("2006-01-02")] = true
+		}
+	}
+
+	var keys []string
+	for d := range days {
+		keys = append(keys, d)
+	}
+	sort.Strings(keys)
+	streak := 0
+	var prev time.Time
+	for _, k := range keys {
+		day, _ := time.ParseInLocation("2006-01-02", k, time.Local)
+		if !prev.IsZero() && prev.AddDate(0, 0, 1).Equal(day) {
+			streak++
+		} else {
+			streak = 1
+		}
+		if streak > summary.LongestStreak {
+			summary.LongestStreak = streak
+		}
+		prev = day
+	}
+	// 当前连续天数需截止到今天或昨天
+	today, _ := time.ParseInLocation("2006-01-02", time.Now().Format("2006-01-02"), time.Local)
+	if !prev.IsZero() && (prev.Equal(today) || prev.AddDate(0, 0, 1).Equal(today)) {
+		summary.CurrentStreak = streak
+	}
+	return summary
+}
+
+// 统计当前歌曲的实际收听时长
+type playTracker struct {
+	mu       sync.Mutex
+	music    *Music
+	start    time.Time
+	last     time.Time
+	listened time.Duration
+}
+
+func (t *playTracker) begin(music *Music) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.music = music
+	t.start = time.Now()
+	t.last = t.start
+	t.listened = 0
+}
+
+func (t *playTracker) tick(playing bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if playing {
+		t.listened += now.Sub(t.last)
+	}
+	t.last = now
+}
+
+func (t *playTracker) end() (PlayRecord, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	music := t.music
+	if music == nil {
+		return PlayRecord{}, false
+	}
+	t.music = nil
+
+	duration := music.Info.Duration
+	finished := false
+	if music.IsInit() {
+		if d := music.Duration(music.Len()); d > 0 {
+			duration = d
+		}
+		finished = music.Len() > 0 && float64(music.Pos()) >= float64(music.Len())*0.98
+	}
+	return PlayRecord{
+		ID:          music.Info.ID,
+		Name:        music.Info.Name,
+		ArtistsName: music.Info.ArtistsName,
+		Source:      music.Source,
+		Start:       t.start,
+		Listened:    t.listened,
+		Duration:    duration,
+		Skipped:     !finished,
+	}, true
+}
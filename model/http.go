@@ -1,6 +1,9 @@
 package model
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/lauthrul/goutil/log"
 	"github.com/valyala/fasthttp"
 	"time"
@@ -8,7 +11,55 @@ import (
 
 var fc = &fasthttp.Client{}
 
+var ErrNotFound = errors.New("not found")
+
+// 网络请求失败(连接错误、超时、离线、非200状态码)
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string { return "network: " + e.Err.Error() }
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// 响应内容解析失败
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string { return "decode: " + e.Err.Error() }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+func IsNetworkError(err error) bool {
+	var e *NetworkError
+	return errors.As(err, &e)
+}
+
+func IsDecodeError(err error) bool {
+	var e *DecodeError
+	return errors.As(err, &e)
+}
+
+// 接口返回的业务错误码，404视为资源不存在
+func codeError(name string, code int, data []byte) error {
+	if code == 404 {
+		return fmt.Errorf("%s http code err[%d]: %w", name, code, ErrNotFound)
+	}
+	return fmt.Errorf("%s http code err[%d]: %s", name, code, string(data))
+}
+
+// 离线模式下不发起请求，请求失败时触发网络探测
 func HttpDoTimeout(body []byte, method string, uri string, headers map[string]string, timeout time.Duration) ([]byte, int, error) {
+	if IsOffline() {
+		return nil, 0, ErrOffline
+	}
+	data, code, err := httpDoTimeout(body, method, uri, headers, timeout)
+	if err != nil {
+		probeNetwork()
+	}
+	return data, code, err
+}
+
+func httpDoTimeout(body []byte, method string, uri string, headers map[string]string, timeout time.Duration) ([]byte, int, error) {
 
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
@@ -37,5 +88,23 @@ func HttpDoTimeout(body []byte, method string, uri string, headers map[string]st
 
 	log.DebugF("%s -> [%d] %v\n", uri, resp.StatusCode(), err)
 
-	return resp.Body(), resp.StatusCode(), err
+	// resp释放后body会被复用，需要拷贝
+	return append([]byte(nil), resp.Body()...), resp.StatusCode(), err
+}
+
+func HttpGetJson(uri string, v interface{}, timeout time.Duration) ([]byte, error) {
+	data, code, err := HttpDoTimeout(nil, fasthttp.MethodGet, uri, nil, timeout)
+	if err != nil {
+		return data, &NetworkError{err}
+	}
+	if code == fasthttp.StatusNotFound {
+		return data, fmt.Errorf("http status err[%d]: %w", code, ErrNotFound)
+	}
+	if code != fasthttp.StatusOK {
+		return data, &NetworkError{fmt.Errorf("http status err[%d]", code)}
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return data, &DecodeError{err}
+	}
+	return data, nil
 }
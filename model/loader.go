@@ -0,0 +1,167 @@
+package model
+
+import (
+	"errors"
+	"github.com/lauthrul/goutil/log"
+	"sync"
+)
+
+// 异步加载歌单和封面，避免在界面线程中等待网络。
+// 同类请求只保留最新的一个，新请求发出时取消之前未完成的请求，相同的请求未完成时复用。
+// 网络请求本身无法中断，被取消的请求完成后结果直接丢弃。
+
+var ErrCanceled = errors.New("canceled")
+
+type LoadKind int
+
+const (
+	LoadChart LoadKind = iota // 歌单歌曲，结果为[]*Music
+	LoadCover                 // 封面，结果为本地文件路径
+)
+
+type LoadState int
+
+const (
+	LoadIdle LoadState = iota
+	LoadLoading
+	LoadDone
+	LoadFailed
+	LoadCanceled
+)
+
+func (s LoadState) String() string {
+	switch s {
+	case LoadLoading:
+		return "加载中"
+	case LoadDone:
+		return "已加载"
+	case LoadFailed:
+		return "加载失败"
+	case LoadCanceled:
+		return "已取消"
+	}
+	return ""
+}
+
+// 一次加载请求的结果，完成或取消后Done关闭
+type Future struct {
+	Kind LoadKind
+	Key  string
+
+	done  chan struct{}
+	once  sync.Once
+	mu    sync.Mutex
+	state LoadState
+	value interface{}
+	err   error
+}
+
+func newFuture(kind LoadKind, key string) *Future {
+	return &Future{Kind: kind, Key: key, done: make(chan struct{}), state: LoadLoading}
+}
+
+// 只有第一次调用生效，返回是否生效
+func (f *Future) finish(state LoadState, value interface{}, err error) bool {
+	finished := false
+	f.once.Do(func() {
+		f.mu.Lock()
+		f.state, f.value, f.err = state, value, err
+		f.mu.Unlock()
+		close(f.done)
+		finished = true
+	})
+	return finished
+}
+
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// 等待加载完成，被取消时返回ErrCanceled
+func (f *Future) Wait() (interface{}, error) {
+	<-f.done
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value, f.err
+}
+
+func (f *Future) State() LoadState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+func (f *Future) Cancel() {
+	f.finish(LoadCanceled, nil, ErrCanceled)
+}
+
+type Loader struct {
+	mu      sync.Mutex
+	pending map[LoadKind]*Future
+}
+
+func NewLoader() *Loader {
+	return &Loader{pending: map[LoadKind]*Future{}}
+}
+
+func (l *Loader) load(kind LoadKind, key string, load func() (interface{}, error)) *Future {
+	l.mu.Lock()
+	if old := l.pending[kind]; old != nil {
+		if old.Key == key && old.State() == LoadLoading {
+			l.mu.Unlock()
+			return old
+		}
+		old.Cancel()
+	}
+	f := newFuture(kind, key)
+	l.pending[kind] = f
+	l.mu.Unlock()
+
+	go func() {
+		value, err := load()
+		state := LoadState(LoadDone)
+		if err != nil {
+			state = LoadFailed
+		}
+		if !f.finish(state, value, err) {
+			log.Debug("drop canceled load:", kind, key)
+		}
+		l.mu.Lock()
+		if l.pending[kind] == f {
+			delete(l.pending, kind)
+		}
+		l.mu.Unlock()
+	}()
+	return f
+}
+
+// 取消kind类未完成的请求
+func (l *Loader) Cancel(kind LoadKind) {
+	l.mu.Lock()
+	f := l.pending[kind]
+	delete(l.pending, kind)
+	l.mu.Unlock()
+	if f != nil {
+		f.Cancel()
+	}
+}
+
+// 按ID提供歌单中的歌曲，如PlaylistStore
+type TrackSource interface {
+	Musics(id string) ([]*Music, error)
+}
+
+// 异步加载歌单中的歌曲
+func (l *Loader) Chart(src TrackSource, id string) *Future {
+	return l.load(LoadChart, id, func() (interface{}, error) {
+		return src.Musics(id)
+	})
+}
+
+// 异步下载封面，info不会被修改，完成后由调用方写入MusicPicLocal
+func (l *Loader) Cover(info MusicInfo) *Future {
+	return l.load(LoadCover, info.CacheName(), func() (interface{}, error) {
+		err := LoadPic(&info)
+		return info.MusicPicLocal, err
+	})
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 设置了gate的歌单在gate关闭后才返回
+type gatedSource struct {
+	mu    sync.Mutex
+	calls map[string]int
+	gates map[string]chan struct{}
+}
+
+func (s *gatedSource) Musics(id string) ([]*Music, error) {
+	s.mu.Lock()
+	s.calls[id]++
+	gate := s.gates[id]
+	s.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if id == "bad" {
+		return nil, ErrNotFound
+	}
+	return []*Music{{Info: MusicInfo{ID: id + "1"}}}, nil
+}
+
+func (s *gatedSource) called(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[id]
+}
+
+func newGatedSource(gated ...string) *gatedSource {
+	s := &gatedSource{calls: map[string]int{}, gates: map[string]chan struct{}{}}
+	for _, id := range gated {
+		s.gates[id] = make(chan struct{})
+	}
+	return s
+}
+
+func waitFuture(t *testing.T, f *Future) (interface{}, error) {
+	t.Helper()
+	select {
+	case <-f.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s not done", f.Key)
+	}
+	return f.Wait()
+}
+
+func TestLoaderStates(t *testing.T) {
+	l := NewLoader()
+	src := newGatedSource()
+
+	value, err := waitFuture(t, l.Chart(src, "a"))
+	if musics, _ := value.([]*Music); err != nil || len(musics) != 1 || musics[0].Info.ID != "a1" {
+		t.Errorf("a = %v, %v", value, err)
+	}
+	f := l.Chart(src, "bad")
+	if _, err = waitFuture(t, f); !errors.Is(err, ErrNotFound) || f.State() != LoadFailed {
+		t.Errorf("bad = %v, state %v", err, f.State())
+	}
+
+	// 完成后再次请求重新加载
+	f = l.Chart(src, "a")
+	if _, err = waitFuture(t, f); err != nil || f.State() != LoadDone || src.called("a") != 2 {
+		t.Errorf("reload a = %v, state %v, calls %d", err, f.State(), src.called("a"))
+	}
+}
+
+func TestLoaderSupersede(t *testing.T) {
+	l := NewLoader()
+	src := newGatedSource("a", "b")
+
+	a := l.Chart(src, "a")
+	b := l.Chart(src, "b")
+	if _, err := waitFuture(t, a); !errors.Is(err, ErrCanceled) || a.State() != LoadCanceled {
+		t.Errorf("a = %v, state %v, want canceled", err, a.State())
+	}
+
+	// 被取消的请求完成后结果丢弃
+	close(src.gates["a"])
+	close(src.gates["b"])
+	if value, err := waitFuture(t, b); err != nil || b.State() != LoadDone || value.([]*Music)[0].Info.ID != "b1" {
+		t.Errorf("b = %v, %v", value, err)
+	}
+	if a.State() != LoadCanceled {
+		t.Errorf("a state = %v after load finished", a.State())
+	}
+}
+
+func TestLoaderReuse(t *testing.T) {
+	l := NewLoader()
+	src := newGatedSource("a")
+
+	a := l.Chart(src, "a")
+	if again := l.Chart(src, "a"); again != a {
+		t.Error("same key should reuse the pending future")
+	}
+	// 其他种类的请求互不影响
+	cover := l.load(LoadCover, "a", func() (interface{}, error) { return "a.jpg", nil })
+	if cover == a {
+		t.Error("different kind reused the future")
+	}
+	close(src.gates["a"])
+	if _, err := waitFuture(t, a); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := waitFuture(t, cover); err != nil || value != "a.jpg" {
+		t.Errorf("cover = %v, %v", value, err)
+	}
+	if n := src.called("a"); n != 1 {
+		t.Errorf("loaded %d times, want 1", n)
+	}
+}
+
+func TestLoaderCancel(t *testing.T) {
+	l := NewLoader()
+	src := newGatedSource("a")
+
+	a := l.Chart(src, "a")
+	l.Cancel(LoadCover) // 没有未完成的请求
+	if a.State() != LoadLoading {
+		t.Errorf("state = %v after canceling another kind", a.State())
+	}
+	l.Cancel(LoadChart)
+	if _, err := waitFuture(t, a); !errors.Is(err, ErrCanceled) {
+		t.Errorf("a = %v, want canceled", err)
+	}
+
+	// 取消后相同的请求重新加载
+	again := l.Chart(src, "a")
+	if again == a {
+		t.Error("reused a canceled future")
+	}
+	close(src.gates["a"])
+	if _, err := waitFuture(t, again); err != nil {
+		t.Error(err)
+	}
+}
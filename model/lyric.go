@@ -0,0 +1,218 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LyricResp struct {
+	Code int `json:"code"`
+	Lrc  struct {
+		Lyric string `json:"lyric"`
+	} `json:"lrc"`
+	Tlyric struct {
+		Lyric string `json:"lyric"`
+	} `json:"tlyric"`
+}
+
+type LyricLine struct {
+	Time        time.Duration `json:"time"`
+	Text        string        `json:"text"`
+	Translation string        `json:"translation"`
+}
+
+type Lyric struct {
+	Tags   map[string]string // ti, ar, al, by 等标签
+	Offset time.Duration
+	Lines  []LyricLine
+}
+
+var (
+	lrcTimeReg = regexp.MustCompile(`^\[(\d+):(\d+)(?:[.:](\d+))?\]`)
+	lrcTagReg  = regexp.MustCompile(`^\[([a-zA-Z]+):(.*)\]$`)
+)
+
+// 解析LRC歌词，支持一行多个时间标签以及[offset:]标签；
+// 时间相同的两行视为原文与翻译，合并为一行
+func ParseLrc(text string) *Lyric {
+	lyric := &Lyric{Tags: map[string]string{}}
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		var times []time.Duration
+		for {
+			m := lrcTimeReg.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			times = append(times, parseLrcTime(m[1], m[2], m[3]))
+			line = line[len(m[0]):]
+		}
+
+		if len(times) == 0 {
+			if m := lrcTagReg.FindStringSubmatch(line); m != nil {
+				key, value := strings.ToLower(m[1]), strings.TrimSpace(m[2])
+				lyric.Tags[key] = value
+				if key == "offset" {
+					if ms, err := strconv.Atoi(value); err == nil {
+						lyric.Offset = time.Duration(ms) * time.Millisecond
+					}
+				}
+			}
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		for _, t := range times {
+			lyric.Lines = append(lyric.Lines, LyricLine{Time: t, Text: line})
+		}
+	}
+
+	// 正的offset表示歌词提前显示
+	for i := range lyric.Lines {
+		lyric.Lines[i].Time -= lyric.Offset
+		if lyric.Lines[i].Time < 0 {
+			lyric.Lines[i].Time = 0
+		}
+	}
+	lyric.Offset = 0
+
+	sort.SliceStable(lyric.Lines, func(i, j int) bool {
+		return lyric.Lines[i].Time < lyric.Lines[j].Time
+	})
+
+	var lines []LyricLine
+	for _, l := range lyric.Lines {
+		if n := len(lines); n > 0 && lines[n-1].Time == l.Time {
+			if lines[n-1].Translation == "" {
+				lines[n-1].Translation = l.Text
+			}
+			continue
+		}
+		lines = append(lines, l)
+	}
+	lyric.Lines = lines
+	return lyric
+}
+
+func parseLrcTime(min, sec, frac string) time.Duration {
+	m, _ := strconv.Atoi(min)
+	s, _ := strconv.Atoi(sec)
+	d := time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	if frac != "" {
+		f, _ := strconv.Atoi(frac)
+		// 百分秒或毫秒
+		for i := len(frac); i < 3; i++ {
+			f *= 10
+		}
+		for i := len(frac); i > 3; i-- {
+			f /= 10
+		}
+		d += time.Duration(f) * time.Millisecond
+	}
+	return d
+}
+
+func formatLrcTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("[%02d:%02d.%03d]", ms/60000, ms/1000%60, ms%1000)
+}
+
+// 合并翻译歌词
+func (l *Lyric) Merge(trans *Lyric) {
+	if trans == nil {
+		return
+	}
+	idx := map[time.Duration]string{}
+	for _, t := range trans.Lines {
+		idx[t.Time] = t.Text
+	}
+	for i := range l.Lines {
+		if t, ok := idx[l.Lines[i].Time]; ok && l.Lines[i].Translation == "" {
+			l.Lines[i].Translation = t
+		}
+	}
+}
+
+// 导出为LRC，翻译行与原文使用相同的时间标签
+func (l *Lyric) String() string {
+	var (
+		sb   strings.Builder
+		keys []string
+	)
+	for k := range l.Tags {
+		if k != "offset" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("[%s:%s]\n", k, l.Tags[k]))
+	}
+	for _, line := range l.Lines {
+		sb.WriteString(formatLrcTime(line.Time) + line.Text + "\n")
+		if line.Translation != "" {
+			sb.WriteString(formatLrcTime(line.Time) + line.Translation + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// 返回d时刻所在的歌词行，没有则返回-1
+func (l *Lyric) LineAt(d time.Duration) int {
+	if l == nil {
+		return -1
+	}
+	return sort.Search(len(l.Lines), func(i int) bool {
+		return l.Lines[i].Time > d
+	}) - 1
+}
+
+func RequestLyric(id string) (*Lyric, error) {
+	var resp LyricResp
+	data, err := HttpGetJson(fmt.Sprintf(Lyrics, id), &resp, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != 200 {
+		return nil, codeError("lyric", resp.Code, data)
+	}
+	lyric := ParseLrc(resp.Lrc.Lyric)
+	lyric.Merge(ParseLrc(resp.Tlyric.Lyric))
+	return lyric, nil
+}
+
+// 加载歌词，优先读取缓存，否则下载并保存到音乐文件旁
+func LoadLyric(info *MusicInfo) (*Lyric, error) {
+	if info.LyricLocal == "" {
+		if res, ok := CheckCaches("cache", info.CacheName(), CacheLyric); ok {
+			info.LyricLocal = res[CacheLyric]
+		}
+	}
+	if info.LyricLocal != "" {
+		data, err := ioutil.ReadFile(info.LyricLocal)
+		if err == nil {
+			return ParseLrc(string(data)), nil
+		}
+	}
+
+	lyric, err := RequestLyric(info.ID)
+	if err != nil {
+		return nil, err
+	}
+	name := "cache/" + info.CacheName() + ".lrc"
+	if err = ioutil.WriteFile(name, []byte(lyric.String()), os.ModePerm); err != nil {
+		return lyric, err
+	}
+	info.LyricLocal = name
+	return lyric, nil
+}
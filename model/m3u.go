@@ -0,0 +1,113 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	m3uHeader = "#EXTM3U"
+	m3uExtInf = "#EXTINF:"
+	m3uWander = "#EXTWANDER:"
+)
+
+func WriteM3U(w io.Writer, infos []MusicInfo, opts PlaylistFileOptions) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, m3uHeader)
+	for _, info := range infos {
+		secs := -1
+		if info.Duration > 0 {
+			secs = int(math.Round(info.Duration.Seconds()))
+		}
+		title := info.Name
+		if info.ArtistsName != "" {
+			title = info.ArtistsName + " - " + info.Name
+		}
+		fmt.Fprintf(bw, "%s%d,%s\n", m3uExtInf, secs, title)
+		if info.ID != "" {
+			fmt.Fprintf(bw, "%s%s:%s\n", m3uWander, ProviderNetease, info.ID)
+		}
+		fmt.Fprintln(bw, trackLocation(info, opts))
+	}
+	return bw.Flush()
+}
+
+func ReadM3U(r io.Reader, opts PlaylistFileOptions) (*ImportResult, error) {
+	var (
+		res      = &ImportResult{}
+		info     MusicInfo
+		provider string
+		scanner  = bufio.NewScanner(r)
+		first    = true
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		switch {
+		case line == "" || line == m3uHeader:
+		case strings.HasPrefix(line, m3uExtInf):
+			// #EXTINF:duration,artist - title
+			ext := strings.TrimPrefix(line, m3uExtInf)
+			title := ""
+			if i := strings.Index(ext, ","); i >= 0 {
+				ext, title = ext[:i], ext[i+1:]
+			}
+			// 时长后可能带有key="value"属性
+			if fields := strings.Fields(ext); len(fields) > 0 {
+				if secs, err := strconv.Atoi(fields[0]); err == nil && secs > 0 {
+					info.Duration = time.Duration(secs) * time.Second
+				}
+			}
+			if i := strings.Index(title, " - "); i >= 0 {
+				info.ArtistsName, info.Name = strings.TrimSpace(title[:i]), strings.TrimSpace(title[i+3:])
+			} else {
+				info.Name = strings.TrimSpace(title)
+			}
+		case strings.HasPrefix(line, m3uWander):
+			// #EXTWANDER:provider:id
+			parts := strings.SplitN(strings.TrimPrefix(line, m3uWander), ":", 2)
+			if len(parts) == 2 {
+				provider, info.ID = parts[0], parts[1]
+			}
+		case strings.HasPrefix(line, "#"):
+			// 其他扩展标签忽略
+		default:
+			if resolveTrack(&info, provider, line, opts) {
+				res.Musics = append(res.Musics, info)
+			} else {
+				res.Unresolved = append(res.Unresolved, line)
+			}
+			info, provider = MusicInfo{}, ""
+		}
+	}
+	return res, scanner.Err()
+}
+
+func ImportM3U(path string) (*ImportResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadM3U(f, PlaylistFileOptions{BaseDir: filepath.Dir(path)})
+}
+
+func ExportM3U(path string, infos []MusicInfo, relative bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteM3U(f, infos, PlaylistFileOptions{BaseDir: filepath.Dir(path), Relative: relative})
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestM3URoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "music", "a b.mp3")
+	if err := os.MkdirAll(filepath.Dir(local), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	infos := []MusicInfo{
+		{Name: "晴天", ArtistsName: "周杰伦", Duration: 269 * time.Second, MusicLocal: local},
+		{ID: "186016", Name: "七里香", ArtistsName: "周杰伦"},
+	}
+
+	var buf bytes.Buffer
+	opts := PlaylistFileOptions{BaseDir: dir, Relative: true}
+	if err := WriteM3U(&buf, infos, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nmusic/a b.mp3\n") || !strings.Contains(buf.String(), "#EXTWANDER:163:186016") {
+		t.Errorf("m3u:\n%s", buf.String())
+	}
+
+	// 其他播放器写出的扩展标签和不存在的文件
+	buf.WriteString("#EXTINF:10 tvg-id=\"x\",无名\n#EXTVLCOPT:network-caching=1000\nmissing.mp3\n")
+	res, err := ReadM3U(&buf, PlaylistFileOptions{BaseDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Musics) != 2 || len(res.Unresolved) != 1 || res.Unresolved[0] != "missing.mp3" {
+		t.Fatalf("result = %+v", res)
+	}
+	a, b := res.Musics[0], res.Musics[1]
+	if a.Name != "晴天" || a.ArtistsName != "周杰伦" || a.Duration != 269*time.Second || a.MusicLocal != local {
+		t.Errorf("local track = %+v", a)
+	}
+	if b.ID != "186016" || b.Name != "七里香" || b.MusicLocal != "" {
+		t.Errorf("remote track = %+v", b)
+	}
+}
+
+func TestResolveTracks(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "a.mp3")
+	if err := ioutil.WriteFile(local, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	list := filepath.Join(dir, "list.m3u")
+	if err := ioutil.WriteFile(list, []byte("#EXTM3U\n#EXTINF:-1,wander - a\na.mp3\nmissing.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	musics, err := ResolveTracks(local)
+	if err != nil || len(musics) != 1 || musics[0].Info.MusicLocal != local || musics[0].Info.Name != "a" {
+		t.Errorf("local file = %v, %v", musics, err)
+	}
+	musics, err = ResolveTracks(list)
+	if err != nil || len(musics) != 1 || musics[0].Info.MusicLocal != local || musics[0].Info.ArtistsName != "wander" {
+		t.Errorf("playlist = %v, %v", musics, err)
+	}
+
+	// 不存在且不是歌曲ID时不请求网络
+	for _, arg := range []string{filepath.Join(dir, "typo.mp3"), "./typo.mp3", "163:abc"} {
+		if _, err = ResolveTracks(arg); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("ResolveTracks(%q) = %v, want not exist", arg, err)
+		}
+	}
+
+	empty := filepath.Join(dir, "empty.m3u")
+	if err = ioutil.WriteFile(empty, []byte("#EXTM3U\nmissing.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ResolveTracks(empty); !errors.Is(err, ErrNotFound) {
+		t.Errorf("empty playlist = %v, want ErrNotFound", err)
+	}
+}
@@ -3,13 +3,16 @@ package model
 import (
 	"fmt"
 	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
 	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
-	"github.com/lauthrul/goutil/log"
+	"math"
 	"os"
 	"time"
 )
 
+const MaxVolume = 100
+
 type MusicInfo struct {
 	ID            string `json:"id"`
 	Name          string `json:"name"`
@@ -18,16 +21,38 @@ type MusicInfo struct {
 	MusicPic      string `json:"music_pic"`
 	MusicLocal    string `json:"music_local"`
 	MusicPicLocal string `json:"music_pic_local"`
+	LyricLocal    string `json:"lyric_local"`
+
+	AlbumName   string        `json:"album_name"`
+	Duration    time.Duration `json:"duration"`
+	DiscNo      int           `json:"disc_no"`
+	TrackNo     int           `json:"track_no"`
+	PublishTime time.Time     `json:"publish_time"`
+
+	Featured *FeaturedComment `json:"featured,omitempty"` // 随机漫游附带的评论
+}
+
+type FeaturedComment struct {
+	NickName  string `json:"nickname"`
+	AvatarUrl string `json:"avatar_url"`
+	Comments  string `json:"comments"`
+}
+
+// 缓存文件名（不含扩展名）
+func (i MusicInfo) CacheName() string {
+	return fmt.Sprintf("%s-%s", i.Name, i.ArtistsName)
 }
 
 type MusicController struct {
 	Streamer beep.StreamSeekCloser
 	Format   beep.Format
 	Ctrl     *beep.Ctrl
+	Volume   *effects.Volume
 }
 
 type Music struct {
 	Info       MusicInfo
+	Source     string // 来源歌单ID
 	controller MusicController
 }
 
@@ -65,23 +90,29 @@ func (m *Music) SetPause(pause bool) {
 	m.controller.Ctrl.Paused = pause
 }
 
-func (m *Music) Play(playCtrl playCtrl) {
+// 第一次播放时打开并解码文件，不支持的格式或文件损坏时返回DecodeError
+func (m *Music) Play(playCtrl playCtrl) error {
 	if !m.IsInit() {
 		f, err := os.Open(m.Info.MusicLocal)
 		if err != nil {
-			log.Error(err)
+			return err
 		}
 
 		streamer, format, err := mp3.Decode(f)
 		if err != nil {
-			log.Error(err)
+			f.Close()
+			return &DecodeError{err}
 		}
 
 		speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-		ctrl := &beep.Ctrl{Streamer: streamer, Paused: false}
-		speaker.Play(ctrl)
+		// 以暂停状态开始时不输出声音，如恢复上次播放
+		ctrl := &beep.Ctrl{Streamer: streamer, Paused: playCtrl.action == ActionPause}
+		volume := &effects.Volume{Streamer: ctrl, Base: 2}
+		setVolume(volume, playCtrl.volume)
+		speaker.Play(volume)
 
 		m.Init(streamer, format, ctrl)
+		m.controller.Volume = volume
 	}
 
 	speaker.Lock()
@@ -91,17 +122,48 @@ func (m *Music) Play(playCtrl playCtrl) {
 		}
 		m.SetPause(false)
 	} else if playCtrl.action == ActionPause {
+		if playCtrl.pos > 0 {
+			m.Seek(playCtrl.pos)
+		}
 		m.SetPause(true)
 	}
 	speaker.Unlock()
+	return nil
+}
+
+// 音量为0-100，按对数换算为beep的音量
+func setVolume(v *effects.Volume, volume int) {
+	if volume < 0 {
+		volume = 0
+	}
+	if volume > MaxVolume {
+		volume = MaxVolume
+	}
+	v.Silent = volume == 0
+	if volume > 0 {
+		v.Volume = math.Log2(float64(volume) / MaxVolume)
+	}
+}
+
+func (m *Music) SetVolume(volume int) {
+	if !m.IsInit() || m.controller.Volume == nil {
+		return
+	}
+	speaker.Lock()
+	setVolume(m.controller.Volume, volume)
+	speaker.Unlock()
 }
 
+// 音频在speaker的goroutine中解码，读写解码器需持有speaker锁
 func (m *Music) Stop() {
 	if m.IsInit() {
+		speaker.Lock()
+		defer speaker.Unlock()
 		m.controller.Streamer.Close()
 		m.controller.Streamer = nil
 		m.controller.Ctrl.Streamer = nil
 		m.controller.Ctrl = nil
+		m.controller.Volume = nil
 		m.controller.Format = beep.Format{}
 	}
 }
@@ -110,6 +172,8 @@ func (m *Music) Pos() int {
 	if !m.IsInit() {
 		return -1
 	}
+	speaker.Lock()
+	defer speaker.Unlock()
 	return m.controller.Streamer.Position()
 }
 
@@ -120,6 +184,22 @@ func (m *Music) Len() int {
 	return m.controller.Streamer.Len()
 }
 
+// 时长对应的采样数，用于定位
+func (m *Music) Samples(d time.Duration) int {
+	if !m.IsInit() {
+		return -1
+	}
+	return m.controller.Format.SampleRate.N(d)
+}
+
+// 当前播放时间，不取整
+func (m *Music) Elapsed() time.Duration {
+	if !m.IsInit() {
+		return -1
+	}
+	return m.controller.Format.SampleRate.D(m.Pos())
+}
+
 func (m *Music) Duration(pos int) time.Duration {
 	if !m.IsInit() {
 		return -1
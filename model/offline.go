@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	chartSnapshotDir = "charts"
+	networkProbeUrl  = "https://music.163.com"
+)
+
+// 离线检测的探测间隔
+var NetworkProbeInterval = 30 * time.Second
+
+var ErrOffline = errors.New("offline")
+
+var (
+	offlineMu     sync.Mutex
+	manualOffline bool // 手动开启离线模式
+	autoOffline   bool // 自动检测到网络不可用
+	probing       bool
+	onOffline     []func(bool)
+)
+
+func IsOffline() bool {
+	offlineMu.Lock()
+	defer offlineMu.Unlock()
+	return manualOffline || autoOffline
+}
+
+func IsManualOffline() bool {
+	offlineMu.Lock()
+	defer offlineMu.Unlock()
+	return manualOffline
+}
+
+// 手动切换离线模式
+func SetOffline(offline bool) {
+	offlineMu.Lock()
+	changed := manualOffline != offline && !autoOffline
+	manualOffline = offline
+	offlineMu.Unlock()
+	if changed {
+		notifyOffline(offline)
+	}
+}
+
+// 离线状态变化时回调
+func OnOfflineChanged(f func(offline bool)) {
+	offlineMu.Lock()
+	defer offlineMu.Unlock()
+	onOffline = append(onOffline, f)
+}
+
+func notifyOffline(offline bool) {
+	offlineMu.Lock()
+	fs := append([]func(bool){}, onOffline...)
+	offlineMu.Unlock()
+	for _, f := range fs {
+		f(offline)
+	}
+}
+
+func setAutoOffline(offline bool) {
+	offlineMu.Lock()
+	before := manualOffline || autoOffline
+	autoOffline = offline
+	after := manualOffline || autoOffline
+	offlineMu.Unlock()
+	if before != after {
+		log.Debug("offline:", after)
+		notifyOffline(after)
+	}
+}
+
+// 请求出错时探测网络，网络不可用则进入离线模式并定时重新探测
+func probeNetwork() {
+	offlineMu.Lock()
+	if probing {
+		offlineMu.Unlock()
+		return
+	}
+	probing = true
+	offlineMu.Unlock()
+
+	go func() {
+		defer func() {
+			offlineMu.Lock()
+			probing = false
+			offlineMu.Unlock()
+		}()
+		for {
+			_, _, err := httpDoTimeout(nil, "GET", networkProbeUrl, nil, 10*time.Second)
+			setAutoOffline(err != nil)
+			if err == nil {
+				return
+			}
+			time.Sleep(NetworkProbeInterval)
+		}
+	}()
+}
+
+// 本地缓存中找到的歌曲，填充本地路径
+func MarkCached(musics []*Music) {
+	for _, m := range musics {
+		if m.Info.MusicLocal != "" {
+			continue
+		}
+		if res, ok := CheckCaches("cache", m.Info.CacheName(), CacheMusic); ok {
+			m.Info.MusicLocal = res[CacheMusic]
+		}
+		if m.Info.MusicPicLocal == "" {
+			if res, ok := CheckCaches("cache", m.Info.CacheName(), CachePic); ok {
+				m.Info.MusicPicLocal = res[CachePic]
+			}
+		}
+	}
+}
+
+// 离线时只有已缓存的歌曲可以播放
+func IsAvailable(info MusicInfo) bool {
+	return info.MusicLocal != "" || !IsOffline()
+}
+
+type chartSnapshot struct {
+	ID     string      `json:"id"`
+	Time   time.Time   `json:"time"`
+	Tracks []MusicInfo `json:"tracks"`
+}
+
+func chartSnapshotFile(id string) string {
+	return fmt.Sprintf("%s/%s.json", chartSnapshotDir, id)
+}
+
+// 保存歌单的最新内容，离线时使用
+func SaveChartSnapshot(id string, musics []*Music) error {
+	if err := os.MkdirAll(dataPath(chartSnapshotDir), os.ModePerm); err != nil {
+		return err
+	}
+	s := chartSnapshot{ID: id, Time: time.Now()}
+	for _, m := range musics {
+		s.Tracks = append(s.Tracks, m.Info)
+	}
+	return saveJson(chartSnapshotFile(id), s)
+}
+
+func LoadChartSnapshot(id string) ([]*Music, time.Time, error) {
+	var s chartSnapshot
+	if err := loadJson(chartSnapshotFile(id), &s); err != nil {
+		return nil, time.Time{}, err
+	}
+	var musics []*Music
+	for _, info := range s.Tracks {
+		musics = append(musics, &Music{Info: info})
+	}
+	MarkCached(musics)
+	return musics, s.Time, nil
+}
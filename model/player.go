@@ -2,98 +2,389 @@ package model
 
 import (
 	"github.com/lauthrul/goutil/log"
+	"sync"
 	"time"
 )
 
 type Action uint
 
 const (
-	ActionStop  Action = 0
-	ActionPlay         = 1
-	ActionPause        = 2
-	ActionNext         = 3
+	ActionStop   Action = 0
+	ActionPlay          = 1
+	ActionPause         = 2
+	ActionNext          = 3
+	ActionLyric         = 4 // 当前歌词行变化
+	ActionRecord        = 5 // 一首歌播放结束，记录收听情况
 )
 
 type PlayCallback struct {
 	Music
 	Action
+	Lyric  LyricLine  // ActionLyric时有效
+	Record PlayRecord // ActionRecord时有效
 }
 
 type playCtrl struct {
 	music  *Music
 	action Action
 	pos    int
+	volume int
+	done   chan struct{} // 不为nil时处理完成后关闭
+	err    chan error    // 不为nil时返回播放结果
 }
 
+type lyricLoaded struct {
+	music *Music
+	lyric *Lyric
+}
+
+// 回调按顺序在后台投递，读取回调的goroutine可以调用Play、Stop等等待播放循环的方法；
+// music和lyric只在播放循环中修改，其他goroutine读取或调用music的方法时需持有mu；
+// 歌曲信息可能被其他goroutine通过UpdateInfo修改，播放循环读取时也需持有mu
 type PlayerManager struct {
 	music          *Music
+	lyric          *Lyric
+	lyricIdx       int
 	chPlayCtrl     chan playCtrl     // 内部播放控制chan
-	chPlayCallback chan PlayCallback // 播放控制回调chan
+	chPlayCallback chan PlayCallback // 播放控制回调chan，为nil时不投递
+	callbacks      []PlayCallback    // 等待投递到chPlayCallback的回调
+	chCallback     chan struct{}     // 有新回调等待投递
+	chLyric        chan lyricLoaded  // 歌词加载完成chan
+	volume         int
+	tracker        playTracker
+	history        *History
+	subscribers    []*subscriber // 其他订阅者，不阻塞播放
+	mu             sync.Mutex    // 保护music、lyric、callbacks、subscribers与volume
 }
 
 func NewPlayerManager(ch chan PlayCallback) *PlayerManager {
-	pm := &PlayerManager{chPlayCtrl: make(chan playCtrl), chPlayCallback: ch}
+	pm := &PlayerManager{
+		chPlayCtrl:     make(chan playCtrl),
+		chPlayCallback: ch,
+		chCallback:     make(chan struct{}, 1),
+		chLyric:        make(chan lyricLoaded),
+		lyricIdx:       -1,
+		volume:         MaxVolume,
+	}
 	pm.init()
 	return pm
 }
 
 func (pm *PlayerManager) init() {
+	if pm.chPlayCallback != nil {
+		go pm.forward()
+	}
 	go func() {
 		for {
 			select {
 			case ctrl := <-pm.chPlayCtrl:
 				pm.play(ctrl)
+			case loaded := <-pm.chLyric:
+				if loaded.music == pm.music {
+					pm.mu.Lock()
+					pm.lyric = loaded.lyric
+					pm.mu.Unlock()
+					pm.lyricIdx = -1
+				}
+			case <-time.After(200 * time.Millisecond):
+				pm.tracker.tick(pm.IsPlaying())
+				pm.updateLyric()
+			}
+		}
+	}()
+}
+
+type subscriber struct {
+	ch      chan PlayCallback
+	done    chan struct{}  // 取消订阅时关闭
+	pending sync.WaitGroup // 等待投递的播放记录
+}
+
+// 订阅播放回调，订阅者处理不及时将丢弃事件，播放记录除外
+func (pm *PlayerManager) Subscribe(size int) <-chan PlayCallback {
+	sub := &subscriber{ch: make(chan PlayCallback, size), done: make(chan struct{})}
+	pm.mu.Lock()
+	pm.subscribers = append(pm.subscribers, sub)
+	pm.mu.Unlock()
+	return sub.ch
+}
+
+func (pm *PlayerManager) Unsubscribe(ch <-chan PlayCallback) {
+	pm.mu.Lock()
+	var sub *subscriber
+	for i, s := range pm.subscribers {
+		if s.ch == ch {
+			sub = s
+			pm.subscribers = append(pm.subscribers[:i], pm.subscribers[i+1:]...)
+			break
+		}
+	}
+	pm.mu.Unlock()
+	if sub == nil {
+		return
+	}
+	close(sub.done)
+	sub.pending.Wait()
+	close(sub.ch)
+}
+
+func (pm *PlayerManager) notify(cb PlayCallback) {
+	pm.mu.Lock()
+	for _, sub := range pm.subscribers {
+		select {
+		case sub.ch <- cb:
+		default:
+			// 播放记录用于统计和上报，不能丢弃，在后台等待订阅者处理
+			if cb.Action == ActionRecord {
+				sub.pending.Add(1)
+				go func(sub *subscriber) {
+					defer sub.pending.Done()
+					select {
+					case sub.ch <- cb:
+					case <-sub.done:
+					}
+				}(sub)
 			}
 		}
+	}
+	if pm.chPlayCallback != nil {
+		pm.callbacks = append(pm.callbacks, cb)
+		select {
+		case pm.chCallback <- struct{}{}:
+		default:
+		}
+	}
+	pm.mu.Unlock()
+}
+
+// 按顺序投递回调，接收方处理慢时只阻塞这里，不阻塞播放循环
+func (pm *PlayerManager) forward() {
+	for range pm.chCallback {
+		pm.mu.Lock()
+		callbacks := pm.callbacks
+		pm.callbacks = nil
+		pm.mu.Unlock()
+		for _, cb := range callbacks {
+			pm.chPlayCallback <- cb
+		}
+	}
+}
+
+// 设置播放历史，每首歌结束时记录
+func (pm *PlayerManager) SetHistory(h *History) {
+	pm.history = h
+}
+
+func (pm *PlayerManager) record() {
+	pm.mu.Lock()
+	rec, ok := pm.tracker.end()
+	pm.mu.Unlock()
+	if !ok {
+		return
+	}
+	if pm.history != nil {
+		var err error
+		if rec, err = pm.history.Record(rec); err != nil {
+			log.Error("record history err:", err)
+		}
+	} else {
+		rec.Counted = DefaultPlayThreshold.Reached(rec.Listened, rec.Duration)
+	}
+	pm.notify(PlayCallback{Music: pm.copyMusic(), Action: ActionRecord, Record: rec})
+}
+
+func (pm *PlayerManager) loadLyric(music *Music) {
+	// 加载到副本，歌词缓存每次按文件名查找，不需要写回
+	pm.mu.Lock()
+	info := music.Info
+	pm.mu.Unlock()
+	go func() {
+		lyric, err := LoadLyric(&info)
+		if err != nil {
+			log.Error("load lyric err:", err)
+		}
+		pm.chLyric <- lyricLoaded{music: music, lyric: lyric}
 	}()
 }
 
+func (pm *PlayerManager) updateLyric() {
+	if pm.lyric == nil || !pm.IsPlaying() {
+		return
+	}
+	idx := pm.lyric.LineAt(pm.music.Elapsed())
+	if idx == pm.lyricIdx || idx < 0 {
+		return
+	}
+	pm.lyricIdx = idx
+	pm.notify(PlayCallback{Music: pm.copyMusic(), Action: ActionLyric, Lyric: pm.lyric.Lines[idx]})
+}
+
+// 在播放循环中切换当前歌曲
+func (pm *PlayerManager) setMusic(music *Music) {
+	pm.mu.Lock()
+	pm.music = music
+	pm.lyric = nil
+	pm.mu.Unlock()
+	pm.lyricIdx = -1
+}
+
+// 其他goroutine读取当前歌曲
+func (pm *PlayerManager) current() *Music {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.music
+}
+
+// 在播放循环中复制当前歌曲，用于回调
+func (pm *PlayerManager) copyMusic() Music {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return *pm.music
+}
+
+// 修改歌曲信息，与播放器读取歌曲信息互斥；music可以不是当前歌曲
+func (pm *PlayerManager) UpdateInfo(music *Music, update func(info *MusicInfo)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	update(&music.Info)
+}
+
+// 在播放循环中关闭当前歌曲的解码器
+func (pm *PlayerManager) stopMusic() {
+	pm.mu.Lock()
+	pm.music.Stop()
+	pm.mu.Unlock()
+}
+
 func (pm *PlayerManager) play(playCtrl playCtrl) {
 	log.Debug("play:", playCtrl)
+	if playCtrl.done != nil {
+		defer close(playCtrl.done)
+	}
+	if playCtrl.action == ActionStop {
+		pm.stop()
+		return
+	}
+	err := pm.start(playCtrl)
+	if playCtrl.err != nil {
+		playCtrl.err <- err
+	}
+}
+
+func (pm *PlayerManager) start(playCtrl playCtrl) error {
+	if playCtrl.music == nil {
+		return nil
+	}
 	if pm.music != playCtrl.music {
 		if pm.music != nil {
-			pm.music.Stop()
+			pm.record()
+			pm.stopMusic()
 		}
-		pm.music = playCtrl.music
+		pm.setMusic(playCtrl.music)
+		pm.tracker.begin(pm.music)
+		pm.loadLyric(pm.music)
+	}
+	if playCtrl.pos >= 0 {
+		pm.lyricIdx = -1
 	}
 
-	pm.music.Play(playCtrl)
+	pm.mu.Lock()
+	err := pm.music.Play(playCtrl)
+	pm.mu.Unlock()
+	if err != nil {
+		// 无法播放的歌曲不计入播放记录
+		pm.mu.Lock()
+		pm.tracker.end()
+		pm.mu.Unlock()
+		pm.setMusic(nil)
+		return err
+	}
 
-	pm.chPlayCallback <- PlayCallback{Music: *pm.music, Action: playCtrl.action}
+	pm.notify(PlayCallback{Music: pm.copyMusic(), Action: playCtrl.action})
+	return nil
 }
 
 func (pm *PlayerManager) Info() MusicInfo {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	if pm.music == nil {
 		return MusicInfo{}
 	}
 	return pm.music.Info
 }
 
+// 当前歌曲的歌词，未加载或没有歌词时返回nil
+func (pm *PlayerManager) Lyric() *Lyric {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.lyric
+}
+
 func (pm *PlayerManager) IsPlaying() bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	return pm.music != nil && pm.music.IsPlaying()
 }
 
-func (pm *PlayerManager) Play(music *Music, action Action, pos int) {
+// 播放、暂停或定位，music为nil时控制当前歌曲；返回时已处理完成
+func (pm *PlayerManager) Play(music *Music, action Action, pos int) error {
 	if music == nil {
-		music = pm.music
+		music = pm.current()
 	}
+	err := make(chan error, 1)
 	pm.chPlayCtrl <- playCtrl{
 		music:  music,
 		action: action,
 		pos:    pos,
+		volume: pm.Volume(),
+		err:    err,
 	}
+	return <-err
 }
 
+func (pm *PlayerManager) Volume() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.volume
+}
+
+// 设置音量，0-100
+func (pm *PlayerManager) SetVolume(volume int) {
+	if volume < 0 {
+		volume = 0
+	}
+	if volume > MaxVolume {
+		volume = MaxVolume
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.volume = volume
+	if pm.music != nil {
+		pm.music.SetVolume(volume)
+	}
+}
+
+// 停止播放，由播放循环处理，返回时已停止
 func (pm *PlayerManager) Stop() {
+	done := make(chan struct{})
+	pm.chPlayCtrl <- playCtrl{action: ActionStop, done: done}
+	<-done
+}
+
+func (pm *PlayerManager) stop() {
 	if pm.music == nil {
 		return
 	}
-	pm.music.Stop()
-	pm.chPlayCallback <- PlayCallback{Music: *pm.music, Action: ActionStop}
-	pm.music = nil
+	pm.record()
+	pm.stopMusic()
+	music := pm.copyMusic()
+	pm.setMusic(nil)
+	pm.notify(PlayCallback{Music: music, Action: ActionStop})
 }
 
 func (pm *PlayerManager) Pos() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	if pm.music == nil {
 		return -1
 	}
@@ -101,13 +392,46 @@ func (pm *PlayerManager) Pos() int {
 }
 
 func (pm *PlayerManager) Len() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	if pm.music == nil {
 		return -1
 	}
 	return pm.music.Len()
 }
 
+func (pm *PlayerManager) Samples(d time.Duration) int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.music == nil {
+		return -1
+	}
+	return pm.music.Samples(d)
+}
+
+// 相对当前位置快进或快退
+func (pm *PlayerManager) SeekBy(d time.Duration) {
+	if pm.Len() < 0 {
+		return
+	}
+	pos := pm.Pos() + pm.Samples(d)
+	if pos < 1 {
+		// pos为0时不会定位
+		pos = 1
+	}
+	if max := pm.Len() - 1; pos > max {
+		pos = max
+	}
+	action := Action(ActionPause)
+	if pm.IsPlaying() {
+		action = ActionPlay
+	}
+	pm.Play(nil, action, pos)
+}
+
 func (pm *PlayerManager) Duration(pos int) time.Duration {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	if pm.music == nil {
 		return -1
 	}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// 订阅者缓冲已满时丢弃其他事件，但播放记录仍会送达
+func TestNotifyKeepsRecords(t *testing.T) {
+	pm := &PlayerManager{chPlayCallback: make(chan PlayCallback, 16)}
+	sub := pm.Subscribe(1)
+
+	pm.notify(PlayCallback{Action: ActionLyric})
+	pm.notify(PlayCallback{Action: ActionLyric})
+	pm.notify(PlayCallback{Action: ActionRecord, Record: PlayRecord{ID: "1"}})
+
+	var got []Action
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case cb := <-sub:
+			got = append(got, cb.Action)
+		case <-timeout:
+			t.Fatalf("got %v, want lyric and record", got)
+		}
+	}
+	if got[0] != ActionLyric || got[1] != ActionRecord {
+		t.Errorf("got %v, want [lyric record]", got)
+	}
+	select {
+	case cb := <-sub:
+		t.Errorf("unexpected event %v", cb.Action)
+	default:
+	}
+
+	// 取消订阅时不再等待投递
+	pm.notify(PlayCallback{Action: ActionLyric})
+	pm.notify(PlayCallback{Action: ActionRecord})
+	pm.Unsubscribe(sub)
+}
+
+// 没有读取回调时不阻塞播放循环，读取回调的goroutine可以等待播放循环
+func TestNotifyDoesNotBlock(t *testing.T) {
+	ch := make(chan PlayCallback)
+	pm := NewPlayerManager(ch)
+	for i := 0; i < 10; i++ {
+		pm.notify(PlayCallback{Action: ActionLyric, Lyric: LyricLine{Text: string(rune('0' + i))}})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			cb := <-ch
+			if want := string(rune('0' + i)); cb.Lyric.Text != want {
+				t.Errorf("callback %d = %q, want %q", i, cb.Lyric.Text, want)
+			}
+			pm.Stop()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callbacks not delivered")
+	}
+}
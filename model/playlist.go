@@ -2,29 +2,55 @@ package model
 
 import (
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// 歌曲详情每批请求的数量
+const SongDetailBatch = 200
+
+type TrackResp struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Artists []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	Album struct {
+		Name        string `json:"name"`
+		PicUrl      string `json:"picUrl"`
+		PublishTime int64  `json:"publishTime"` // 毫秒
+	} `json:"album"`
+	Duration int    `json:"duration"` // 毫秒
+	No       int    `json:"no"`
+	Disc     string `json:"disc"`
+}
+
 type PlaylistResp struct {
 	Code   int `json:"code"`
 	Result struct {
-		Tracks []struct {
-			ID      int    `json:"id"`
-			Name    string `json:"name"`
-			Artists []struct {
-				Name string `json:"name"`
-			} `json:"artists"`
-			Album struct {
-				//Name   string `json:"name"`
-				PicUrl string `json:"picUrl"`
-			} `json:"album"`
-		} `json:"tracks"`
+		ID       int         `json:"id"`
+		Name     string      `json:"name"`
+		Tracks   []TrackResp `json:"tracks"`
+		TrackIds []struct {
+			ID int `json:"id"`
+		} `json:"trackIds"`
 	} `json:"result"`
 }
 
+type SongDetailResp struct {
+	Code  int         `json:"code"`
+	Songs []TrackResp `json:"songs"`
+}
+
 func WalkPlaylist(playlist *PlaylistResp) []*Music {
+	return WalkTracks(playlist.Result.Tracks)
+}
+
+func WalkTracks(tracks []TrackResp) []*Music {
 	var musics []*Music
-	for _, track := range playlist.Result.Tracks {
+	for _, track := range tracks {
 		music := &Music{
 			Info: MusicInfo{
 				ID:            fmt.Sprintf("%d", track.ID),
@@ -34,8 +60,18 @@ func WalkPlaylist(playlist *PlaylistResp) []*Music {
 				MusicPic:      track.Album.PicUrl,
 				MusicLocal:    "",
 				MusicPicLocal: "",
+				AlbumName:     track.Album.Name,
+				Duration:      time.Duration(track.Duration) * time.Millisecond,
+				TrackNo:       track.No,
 			},
 		}
+		// disc可能为"1"或"1/2"
+		if disc := strings.Split(track.Disc, "/")[0]; disc != "" {
+			music.Info.DiscNo, _ = strconv.Atoi(strings.TrimSpace(disc))
+		}
+		if track.Album.PublishTime > 0 {
+			music.Info.PublishTime = time.Unix(0, track.Album.PublishTime*int64(time.Millisecond))
+		}
 		for _, artist := range track.Artists {
 			music.Info.ArtistsName += artist.Name + ","
 		}
@@ -44,3 +80,88 @@ func WalkPlaylist(playlist *PlaylistResp) []*Music {
 	}
 	return musics
 }
+
+// 批量获取歌曲详情
+func RequestSongDetails(ids []string) ([]*Music, error) {
+	var musics []*Music
+	for start := 0; start < len(ids); start += SongDetailBatch {
+		end := start + SongDetailBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var resp SongDetailResp
+		param := url.QueryEscape("[" + strings.Join(ids[start:end], ",") + "]")
+		data, err := HttpGetJson(fmt.Sprintf(SongDetail, param), &resp, 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Code != 200 {
+			return nil, codeError("song detail", resp.Code, data)
+		}
+		musics = append(musics, WalkTracks(resp.Songs)...)
+	}
+	return musics, nil
+}
+
+// 获取单曲详情，不存在时返回ErrNotFound
+func RequestSong(id string) (*Music, error) {
+	musics, err := RequestSongDetails([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(musics) == 0 {
+		return nil, fmt.Errorf("song %s %w", id, ErrNotFound)
+	}
+	return musics[0], nil
+}
+
+func RequestPlaylist(id string) (*PlaylistResp, error) {
+	var playlist PlaylistResp
+	data, err := HttpGetJson(fmt.Sprintf(Playlist, id), &playlist, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.Code != 200 {
+		return nil, codeError("playlist", playlist.Code, data)
+	}
+	return &playlist, nil
+}
+
+// 加载完整歌单，tracks之外的歌曲通过trackIds批量获取详情，保持歌单顺序
+func LoadPlaylist(id string) ([]*Music, error) {
+	playlist, err := RequestPlaylist(id)
+	if err != nil {
+		return nil, err
+	}
+	musics := WalkPlaylist(playlist)
+	if len(playlist.Result.TrackIds) <= len(musics) {
+		return musics, nil
+	}
+
+	known := map[string]*Music{}
+	for _, m := range musics {
+		known[m.Info.ID] = m
+	}
+	var missing []string
+	for _, t := range playlist.Result.TrackIds {
+		id := fmt.Sprintf("%d", t.ID)
+		if known[id] == nil {
+			missing = append(missing, id)
+		}
+	}
+	details, err := RequestSongDetails(missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range details {
+		known[m.Info.ID] = m
+	}
+
+	ordered := make([]*Music, 0, len(playlist.Result.TrackIds))
+	for _, t := range playlist.Result.TrackIds {
+		if m := known[fmt.Sprintf("%d", t.ID)]; m != nil {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered, nil
+}
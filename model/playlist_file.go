@@ -0,0 +1,140 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const ProviderNetease = "163"
+
+var outerIdReg = regexp.MustCompile(`music\.163\.com/song/media/outer/url\?id=(\d+)`)
+
+// 导入结果，Unresolved为无法对应到本地缓存或网络歌曲的条目
+type ImportResult struct {
+	Musics     []MusicInfo
+	Unresolved []string
+}
+
+type PlaylistFileOptions struct {
+	BaseDir  string // 相对路径的基准目录，一般为播放列表文件所在目录
+	Relative bool   // 导出时本地文件使用相对路径
+}
+
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// 歌曲在播放列表文件中的位置，优先使用本地缓存
+func trackLocation(info MusicInfo, opts PlaylistFileOptions) string {
+	if info.MusicLocal != "" {
+		location, err := filepath.Abs(info.MusicLocal)
+		if err != nil {
+			location = info.MusicLocal
+		}
+		if opts.Relative && opts.BaseDir != "" {
+			if base, err := filepath.Abs(opts.BaseDir); err == nil {
+				if rel, err := filepath.Rel(base, location); err == nil {
+					location = rel
+				}
+			}
+		}
+		return filepath.ToSlash(location)
+	}
+	if info.ID != "" {
+		return fmt.Sprintf(OuterUrl, info.ID)
+	}
+	return info.MusicUrl
+}
+
+// 将播放列表中的位置解析为歌曲，返回是否解析成功
+func resolveTrack(info *MusicInfo, provider, location string, opts PlaylistFileOptions) bool {
+	if provider != "" && provider != ProviderNetease {
+		info.ID = ""
+	}
+	if location != "" {
+		if isRemote(location) {
+			if m := outerIdReg.FindStringSubmatch(location); m != nil && info.ID == "" {
+				info.ID = m[1]
+			} else if info.ID == "" {
+				info.MusicUrl = location
+			}
+		} else {
+			path := filepath.FromSlash(location)
+			if !filepath.IsAbs(path) && opts.BaseDir != "" {
+				path = filepath.Join(opts.BaseDir, path)
+			}
+			if _, err := os.Stat(path); err == nil {
+				info.MusicLocal = path
+			}
+		}
+	}
+	if info.MusicLocal == "" && info.Name != "" {
+		if res, ok := CheckCaches("cache", info.CacheName(), CacheMusic); ok {
+			info.MusicLocal = res[CacheMusic]
+		}
+	}
+	return info.MusicLocal != "" || info.ID != "" || info.MusicUrl != ""
+}
+
+// 按扩展名导入m3u/m3u8/xspf/pls播放列表
+func ImportPlaylistFile(path string) (*ImportResult, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u", ".m3u8":
+		return ImportM3U(path)
+	case ".xspf":
+		return ImportXSPF(path)
+	case ".pls":
+		return ImportPLS(path)
+	}
+	return nil, fmt.Errorf("unsupported playlist file: %s", path)
+}
+
+// 按扩展名导出播放列表
+func ExportPlaylistFile(path, title string, infos []MusicInfo, relative bool) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u", ".m3u8":
+		return ExportM3U(path, infos, relative)
+	case ".xspf":
+		return ExportXSPF(path, title, infos, relative)
+	case ".pls":
+		return ExportPLS(path, infos, relative)
+	}
+	return fmt.Errorf("unsupported playlist file: %s", path)
+}
+
+// 解析播放参数：播放列表文件、本地音频文件或歌曲ID（可带163:前缀）
+// 不是文件也不是纯数字时返回文件不存在的错误，不发起网络请求
+func ResolveTracks(arg string) ([]*Music, error) {
+	if _, err := os.Stat(arg); err != nil {
+		id := strings.TrimPrefix(arg, ProviderNetease+":")
+		if _, parseErr := strconv.ParseUint(id, 10, 64); parseErr != nil {
+			return nil, err
+		}
+		music, err := RequestSong(id)
+		if err != nil {
+			return nil, err
+		}
+		return []*Music{music}, nil
+	}
+	switch strings.ToLower(filepath.Ext(arg)) {
+	case ".m3u", ".m3u8", ".xspf", ".pls":
+		res, err := ImportPlaylistFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		var musics []*Music
+		for _, info := range res.Musics {
+			musics = append(musics, &Music{Info: info})
+		}
+		if len(musics) == 0 {
+			return nil, fmt.Errorf("no playable track in %s: %w", arg, ErrNotFound)
+		}
+		return musics, nil
+	}
+	name := strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))
+	return []*Music{{Info: MusicInfo{Name: name, MusicLocal: arg}}}, nil
+}
@@ -0,0 +1,365 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const playlistStoreFile = "playlists.json"
+
+type PlaylistKind string
+
+const (
+	PlaylistLocal   PlaylistKind = "local"   // 本地歌单
+	PlaylistRemote  PlaylistKind = "remote"  // 订阅的网易云歌单
+	PlaylistVirtual PlaylistKind = "virtual" // 自动生成的歌单
+)
+
+// 虚拟歌单“我的收藏”
+const FavoritesID = "favorites"
+
+type StoredPlaylist struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Kind    PlaylistKind `json:"kind"`
+	Tracks  []MusicInfo  `json:"tracks,omitempty"` // 仅本地歌单
+	Created time.Time    `json:"created"`
+	Updated time.Time    `json:"updated"`
+}
+
+// 默认订阅的排行榜
+var DefaultCharts = []StoredPlaylist{
+	{ID: "2250011882", Name: "抖音排行榜", Kind: PlaylistRemote},
+	{ID: "3778678", Name: "云音乐热歌榜", Kind: PlaylistRemote},
+	{ID: "3779629", Name: "云音乐新歌榜", Kind: PlaylistRemote},
+	{ID: "19723756", Name: "云音乐飙升榜", Kind: PlaylistRemote},
+}
+
+var (
+	ErrPlaylistNotFound = fmt.Errorf("playlist %w", ErrNotFound)
+	ErrPlaylistExists   = errors.New("playlist already exists")
+	ErrPlaylistReadOnly = errors.New("remote playlist is read only")
+	ErrIndexOutOfRange  = errors.New("index out of range")
+	ErrInvalidPlaylist  = errors.New("invalid playlist id or url")
+
+	playlistIdReg = regexp.MustCompile(`(?:^|[?&/])id=(\d+)`)
+	digitsReg     = regexp.MustCompile(`^\d+$`)
+)
+
+// 持久化的歌单列表
+type PlaylistStore struct {
+	mu        sync.Mutex
+	playlists []*StoredPlaylist
+	favorites *FavoriteStore
+}
+
+func NewPlaylistStore() (*PlaylistStore, error) {
+	s := &PlaylistStore{}
+	err := loadStore(playlistStoreFile, &s.playlists)
+	// 文件损坏时已备份，与首次运行一样使用默认歌单
+	var corrupt *CorruptError
+	if errors.Is(err, os.ErrNotExist) || errors.As(err, &corrupt) {
+		now := time.Now()
+		s.playlists = nil
+		for _, c := range DefaultCharts {
+			c := c
+			c.Created, c.Updated = now, now
+			s.playlists = append(s.playlists, &c)
+		}
+		if saveErr := s.save(); corrupt == nil {
+			err = saveErr
+		}
+	}
+	return s, err
+}
+
+func (s *PlaylistStore) save() error {
+	return saveJson(playlistStoreFile, s.playlists)
+}
+
+// 关联收藏，列表中自动加入“我的收藏”
+func (s *PlaylistStore) AttachFavorites(f *FavoriteStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.favorites = f
+}
+
+func (s *PlaylistStore) virtual(id string) *StoredPlaylist {
+	if id != FavoritesID || s.favorites == nil {
+		return nil
+	}
+	return &StoredPlaylist{ID: FavoritesID, Name: "我的收藏", Kind: PlaylistVirtual, Tracks: s.favorites.Favorites()}
+}
+
+func (s *PlaylistStore) find(id string) (int, *StoredPlaylist) {
+	for i, p := range s.playlists {
+		if p.ID == id {
+			return i, p
+		}
+	}
+	return -1, nil
+}
+
+func (s *PlaylistStore) List() []StoredPlaylist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []StoredPlaylist
+	if v := s.virtual(FavoritesID); v != nil {
+		list = append(list, *v)
+	}
+	for _, p := range s.playlists {
+		list = append(list, *p)
+	}
+	return list
+}
+
+func (s *PlaylistStore) Get(id string) (StoredPlaylist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := s.virtual(id); v != nil {
+		return *v, nil
+	}
+	_, p := s.find(id)
+	if p == nil {
+		return StoredPlaylist{}, ErrPlaylistNotFound
+	}
+	return *p, nil
+}
+
+// 新建本地歌单
+func (s *PlaylistStore) Create(name string) (StoredPlaylist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	p := &StoredPlaylist{
+		ID:      fmt.Sprintf("local-%d", now.UnixNano()),
+		Name:    name,
+		Kind:    PlaylistLocal,
+		Created: now,
+		Updated: now,
+	}
+	s.playlists = append(s.playlists, p)
+	return *p, s.save()
+}
+
+// 以导入的歌曲新建本地歌单
+func (s *PlaylistStore) Import(name string, infos []MusicInfo) (StoredPlaylist, error) {
+	p, err := s.Create(name)
+	if err != nil {
+		return p, err
+	}
+	if err = s.AddTracks(p.ID, -1, infos...); err != nil {
+		return p, err
+	}
+	return s.Get(p.ID)
+}
+
+func (s *PlaylistStore) Rename(id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, p := s.find(id)
+	if p == nil {
+		return ErrPlaylistNotFound
+	}
+	p.Name = name
+	p.Updated = time.Now()
+	return s.save()
+}
+
+func (s *PlaylistStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, _ := s.find(id)
+	if i < 0 {
+		return ErrPlaylistNotFound
+	}
+	s.playlists = append(s.playlists[:i], s.playlists[i+1:]...)
+	return s.save()
+}
+
+// 调整歌单在列表中的位置
+func (s *PlaylistStore) Move(id string, to int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, p := s.find(id)
+	if p == nil {
+		return ErrPlaylistNotFound
+	}
+	if to < 0 || to >= len(s.playlists) {
+		return ErrIndexOutOfRange
+	}
+	s.playlists = append(s.playlists[:i], s.playlists[i+1:]...)
+	s.playlists = append(s.playlists[:to], append([]*StoredPlaylist{p}, s.playlists[to:]...)...)
+	return s.save()
+}
+
+func (s *PlaylistStore) local(id string) (*StoredPlaylist, error) {
+	_, p := s.find(id)
+	if p == nil {
+		return nil, ErrPlaylistNotFound
+	}
+	if p.Kind != PlaylistLocal {
+		return nil, ErrPlaylistReadOnly
+	}
+	return p, nil
+}
+
+// 添加歌曲到本地歌单，pos<0时追加到末尾
+func (s *PlaylistStore) AddTracks(id string, pos int, infos ...MusicInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.local(id)
+	if err != nil {
+		return err
+	}
+	if pos < 0 || pos > len(p.Tracks) {
+		pos = len(p.Tracks)
+	}
+	tracks := make([]MusicInfo, 0, len(p.Tracks)+len(infos))
+	tracks = append(tracks, p.Tracks[:pos]...)
+	tracks = append(tracks, infos...)
+	tracks = append(tracks, p.Tracks[pos:]...)
+	p.Tracks = tracks
+	p.Updated = time.Now()
+	return s.save()
+}
+
+func (s *PlaylistStore) RemoveTrack(id string, idx int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.local(id)
+	if err != nil {
+		return err
+	}
+	if idx < 0 || idx >= len(p.Tracks) {
+		return ErrIndexOutOfRange
+	}
+	p.Tracks = append(p.Tracks[:idx], p.Tracks[idx+1:]...)
+	p.Updated = time.Now()
+	return s.save()
+}
+
+func (s *PlaylistStore) MoveTrack(id string, from, to int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.local(id)
+	if err != nil {
+		return err
+	}
+	if from < 0 || from >= len(p.Tracks) || to < 0 || to >= len(p.Tracks) {
+		return ErrIndexOutOfRange
+	}
+	t := p.Tracks[from]
+	p.Tracks = append(p.Tracks[:from], p.Tracks[from+1:]...)
+	p.Tracks = append(p.Tracks[:to], append([]MusicInfo{t}, p.Tracks[to:]...)...)
+	p.Updated = time.Now()
+	return s.save()
+}
+
+// 从歌单ID或分享链接中解析网易云歌单ID
+// 如 https://music.163.com/#/playlist?id=3778678
+func ParsePlaylistID(s string) (string, error) {
+	if digitsReg.MatchString(s) {
+		return s, nil
+	}
+	if m := playlistIdReg.FindStringSubmatch(s); m != nil {
+		return m[1], nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidPlaylist, s)
+}
+
+// 订阅网易云歌单
+func (s *PlaylistStore) Subscribe(idOrUrl string) (StoredPlaylist, error) {
+	id, err := ParsePlaylistID(idOrUrl)
+	if err != nil {
+		return StoredPlaylist{}, err
+	}
+	s.mu.Lock()
+	_, exist := s.find(id)
+	s.mu.Unlock()
+	if exist != nil {
+		return *exist, ErrPlaylistExists
+	}
+
+	resp, err := RequestPlaylist(id)
+	if err != nil {
+		return StoredPlaylist{}, err
+	}
+	name := resp.Result.Name
+	if name == "" {
+		name = id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	p := &StoredPlaylist{ID: id, Name: name, Kind: PlaylistRemote, Created: now, Updated: now}
+	s.playlists = append(s.playlists, p)
+	return *p, s.save()
+}
+
+// 歌单中的歌曲，订阅的歌单从网络加载
+func (s *PlaylistStore) Musics(id string) ([]*Music, error) {
+	p, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind == PlaylistRemote {
+		return loadRemotePlaylist(p.ID)
+	}
+	var musics []*Music
+	for _, info := range p.Tracks {
+		musics = append(musics, &Music{Info: info})
+	}
+	if IsOffline() {
+		MarkCached(musics)
+	}
+	return musics, nil
+}
+
+// 已保存的歌单按保存方式加载，否则视为网易云歌单ID或链接，返回解析后的歌单ID
+func (s *PlaylistStore) Load(idOrUrl string) (string, []*Music, error) {
+	if _, err := s.Get(idOrUrl); err == nil {
+		musics, err := s.Musics(idOrUrl)
+		return idOrUrl, musics, err
+	}
+	id, err := ParsePlaylistID(idOrUrl)
+	if err != nil {
+		return "", nil, err
+	}
+	musics, err := LoadPlaylist(id)
+	return id, musics, err
+}
+
+// 在线时加载并保存快照，离线或加载失败时使用最近的快照
+func loadRemotePlaylist(id string) ([]*Music, error) {
+	var loadErr error
+	if !IsOffline() {
+		musics, err := LoadPlaylist(id)
+		if err == nil {
+			if err := SaveChartSnapshot(id, musics); err != nil {
+				log.Error("save chart snapshot err:", err)
+			}
+			if err := RecordChartSnapshot(id, musics); err != nil {
+				log.Error("record chart history err:", err)
+			}
+			return musics, nil
+		}
+		log.Error("load playlist err, fallback to snapshot:", err)
+		loadErr = err
+	}
+	musics, _, err := LoadChartSnapshot(id)
+	if err != nil {
+		// 没有快照时返回加载失败的原因
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return nil, fmt.Errorf("no snapshot for playlist %s: %v", id, err)
+	}
+	return musics, nil
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func WritePLS(w io.Writer, infos []MusicInfo, opts PlaylistFileOptions) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	for i, info := range infos {
+		n := i + 1
+		secs := -1
+		if info.Duration > 0 {
+			secs = int(math.Round(info.Duration.Seconds()))
+		}
+		title := info.Name
+		if info.ArtistsName != "" {
+			title = info.ArtistsName + " - " + info.Name
+		}
+		fmt.Fprintf(bw, "File%d=%s\n", n, trackLocation(info, opts))
+		fmt.Fprintf(bw, "Title%d=%s\n", n, title)
+		fmt.Fprintf(bw, "Length%d=%d\n", n, secs)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(infos))
+	fmt.Fprintln(bw, "Version=2")
+	return bw.Flush()
+}
+
+func ReadPLS(r io.Reader, opts PlaylistFileOptions) (*ImportResult, error) {
+	type plsEntry struct {
+		file, title string
+		length      int
+	}
+	var (
+		entries = map[int]*plsEntry{}
+		scanner = bufio.NewScanner(r)
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.ToLower(line[:i]), strings.TrimSpace(line[i+1:])
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		e := entries[n]
+		if e == nil {
+			e = &plsEntry{length: -1}
+			entries[n] = e
+		}
+		switch field {
+		case "file":
+			e.file = value
+		case "title":
+			e.title = value
+		case "length":
+			e.length, _ = strconv.Atoi(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []int
+	for n := range entries {
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+
+	res := &ImportResult{}
+	for _, n := range keys {
+		e := entries[n]
+		var info MusicInfo
+		if i := strings.Index(e.title, " - "); i >= 0 {
+			info.ArtistsName, info.Name = strings.TrimSpace(e.title[:i]), strings.TrimSpace(e.title[i+3:])
+		} else {
+			info.Name = e.title
+		}
+		if e.length > 0 {
+			info.Duration = time.Duration(e.length) * time.Second
+		}
+		if resolveTrack(&info, "", e.file, opts) {
+			res.Musics = append(res.Musics, info)
+		} else {
+			res.Unresolved = append(res.Unresolved, e.file)
+		}
+	}
+	return res, nil
+}
+
+func ImportPLS(path string) (*ImportResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPLS(f, PlaylistFileOptions{BaseDir: filepath.Dir(path)})
+}
+
+func ExportPLS(path string, infos []MusicInfo, relative bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WritePLS(f, infos, PlaylistFileOptions{BaseDir: filepath.Dir(path), Relative: relative})
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+type PlayMode int
+
+const (
+	PlayModeOrder     PlayMode = 0 // 顺序播放
+	PlayModeShuffle   PlayMode = 1 // 随机播放
+	PlayModeRepeatOne PlayMode = 2 // 单曲循环
+)
+
+const (
+	EarlySkip      = 15 * time.Second // 在此时间内切歌视为快速跳过
+	EarlySkipLimit = 2                // 快速跳过达到此次数后开始降权
+)
+
+func (m PlayMode) String() string {
+	switch m {
+	case PlayModeShuffle:
+		return "随机"
+	case PlayModeRepeatOne:
+		return "单曲"
+	}
+	return "顺序"
+}
+
+// 根据屏蔽列表和快速跳过记录计算歌曲权重
+type Ranker struct {
+	Blocklist *Blocklist
+	History   *History
+}
+
+// 屏蔽或离线不可播放的歌曲权重为0，反复快速跳过的歌曲权重逐次减半
+func (r *Ranker) weights() func(info MusicInfo) float64 {
+	var skips map[string]int
+	if r != nil && r.History != nil {
+		skips = r.History.EarlySkips(EarlySkip)
+	}
+	return func(info MusicInfo) float64 {
+		if !IsAvailable(info) {
+			return 0
+		}
+		if r == nil {
+			return 1
+		}
+		if r.Blocklist != nil && r.Blocklist.IsBlocked(info) {
+			return 0
+		}
+		if n := skips[info.ID]; n >= EarlySkipLimit {
+			return math.Pow(0.5, float64(n-EarlySkipLimit+1))
+		}
+		return 1
+	}
+}
+
+func (r *Ranker) Weight(info MusicInfo) float64 {
+	return r.weights()(info)
+}
+
+// 计算上一首/下一首的位置，step为1或-1；全部被屏蔽时返回-1
+func (r *Ranker) NextIndex(musics []*Music, cur, step int, mode PlayMode) int {
+	n := len(musics)
+	if n == 0 {
+		return -1
+	}
+	weight := r.weights()
+
+	switch mode {
+	case PlayModeRepeatOne:
+		if cur >= 0 && cur < n && weight(musics[cur].Info) > 0 {
+			return cur
+		}
+	case PlayModeShuffle:
+		total := 0.0
+		ws := make([]float64, n)
+		for i, m := range musics {
+			if i == cur && n > 1 {
+				continue
+			}
+			ws[i] = weight(m.Info)
+			total += ws[i]
+		}
+		if total <= 0 {
+			return -1
+		}
+		x := rand.Float64() * total
+		for i, w := range ws {
+			if x < w {
+				return i
+			}
+			x -= w
+		}
+		return -1
+	}
+
+	// 顺序播放，跳过被屏蔽的歌曲
+	if step == 0 {
+		step = 1
+	}
+	idx := cur
+	for i := 0; i < n; i++ {
+		idx = ((idx+step)%n + n) % n
+		if weight(musics[idx].Info) > 0 {
+			return idx
+		}
+	}
+	return -1
+}
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
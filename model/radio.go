@@ -0,0 +1,227 @@
+package model
+
+import (
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRadioBuffer  = 3   // 预加载的歌曲数
+	DefaultRadioHistory = 200 // 用于去重的播放历史长度
+	radioMaxRetry       = 10  // 连续重复或被屏蔽时的最大重试次数
+)
+
+// 随机漫游电台，后台维护一个即将播放的歌曲缓冲区
+type Radio struct {
+	size       int
+	maxHistory int
+
+	mu      sync.Mutex
+	buffer  []*Music
+	history []string
+	played  map[string]bool
+
+	ranker *Ranker
+
+	chFill chan struct{}
+	chStop chan struct{} // 运行时不为nil，停止时关闭
+}
+
+func NewRadio(size int) *Radio {
+	if size <= 0 {
+		size = DefaultRadioBuffer
+	}
+	return &Radio{
+		size:       size,
+		maxHistory: DefaultRadioHistory,
+		played:     map[string]bool{},
+		chFill:     make(chan struct{}, 1),
+	}
+}
+
+// 设置屏蔽与降权规则
+func (r *Radio) SetRanker(ranker *Ranker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ranker = ranker
+}
+
+// 开始在后台填充缓冲区，停止后可再次开始
+func (r *Radio) Start() {
+	r.mu.Lock()
+	if r.chStop == nil {
+		r.chStop = make(chan struct{})
+		go r.run(r.chStop)
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *Radio) run(stop chan struct{}) {
+	for {
+		select {
+		case <-r.chFill:
+			r.fill(stop)
+		case <-time.After(30 * time.Second):
+			r.fill(stop)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// 停止后台填充，离开漫游时调用，已缓冲的歌曲保留
+func (r *Radio) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.chStop != nil {
+		close(r.chStop)
+		r.chStop = nil
+	}
+}
+
+func (r *Radio) notify() {
+	select {
+	case r.chFill <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Radio) fill(stop chan struct{}) {
+	for r.Len() < r.size {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		music, err := r.request()
+		if err != nil {
+			log.Error("radio fill err:", err)
+			return
+		}
+		r.mu.Lock()
+		r.buffer = append(r.buffer, music)
+		r.mu.Unlock()
+	}
+}
+
+func (r *Radio) request() (*Music, error) {
+	var loadErr error
+	for i := 0; i < radioMaxRetry; i++ {
+		randomInfo, err := RequestRandom()
+		if err != nil {
+			return nil, err
+		}
+		info := randomInfo.MusicInfo()
+		r.mu.Lock()
+		ranker := r.ranker
+		r.mu.Unlock()
+		if w := ranker.Weight(info); rand.Float64() >= w {
+			log.Debug("radio skip by rank:", info.ID, info.Name, w)
+			continue
+		}
+		// 标记为已选，避免缓冲区内重复
+		if !r.claim(info.ID) {
+			log.Debug("radio skip repeat:", info.ID, info.Name)
+			continue
+		}
+		music := &Music{Info: info}
+		if err = LoadPic(&music.Info); err != nil {
+			log.Error("radio load pic err:", err)
+		}
+		if err = LoadMusic(&music.Info); err != nil {
+			// 下载失败的歌曲以后还可以再选中
+			log.Error("radio load music err:", info.ID, err)
+			r.release(info.ID)
+			loadErr = err
+			continue
+		}
+		return music, nil
+	}
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return nil, fmt.Errorf("too many repeated random musics")
+}
+
+// 未播放过时标记为已选，检查与标记在同一次加锁中完成，填充与Next同时请求时不会选中同一首
+func (r *Radio) claim(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.played[id] {
+		return false
+	}
+	r.mark(id)
+	return true
+}
+
+// 撤销claim的标记
+func (r *Radio) release(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.played[id] {
+		return
+	}
+	delete(r.played, id)
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if r.history[i] == id {
+			r.history = append(r.history[:i], r.history[i+1:]...)
+			break
+		}
+	}
+}
+
+// 记录播放历史
+func (r *Radio) MarkPlayed(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.played[id] {
+		r.mark(id)
+	}
+}
+
+// 需持有锁
+func (r *Radio) mark(id string) {
+	r.played[id] = true
+	r.history = append(r.history, id)
+	if len(r.history) > r.maxHistory {
+		delete(r.played, r.history[0])
+		r.history = r.history[1:]
+	}
+}
+
+func (r *Radio) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.buffer)
+}
+
+// 即将播放的歌曲
+func (r *Radio) Upcoming() []MusicInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var infos []MusicInfo
+	for _, m := range r.buffer {
+		infos = append(infos, m.Info)
+	}
+	return infos
+}
+
+// 取出下一首，缓冲区为空时同步请求
+func (r *Radio) Next() (*Music, error) {
+	defer r.notify()
+
+	r.mu.Lock()
+	if len(r.buffer) > 0 {
+		music := r.buffer[0]
+		r.buffer = r.buffer[1:]
+		r.mu.Unlock()
+		return music, nil
+	}
+	r.mu.Unlock()
+
+	return r.request()
+}
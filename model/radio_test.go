@@ -0,0 +1,79 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRadioClaim(t *testing.T) {
+	r := NewRadio(1)
+	var (
+		wg      sync.WaitGroup
+		claimed int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r.claim("1") {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("claimed %d times, want 1", claimed)
+	}
+
+	// 撤销后可再次选中，不占用历史长度
+	r.release("1")
+	if len(r.history) != 0 || !r.claim("1") {
+		t.Errorf("claim after release = false, history %v", r.history)
+	}
+
+	// 超出历史长度后可再次选中
+	r.maxHistory = 2
+	r.MarkPlayed("2")
+	r.MarkPlayed("3")
+	if !r.claim("1") {
+		t.Error("claim after history rotated = false")
+	}
+}
+
+func TestRadioRestart(t *testing.T) {
+	r := NewRadio(1)
+	// 缓冲区已满，填充时不请求
+	r.buffer = []*Music{{Info: MusicInfo{ID: "1"}}}
+	stopCh := func() chan struct{} {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.chStop
+	}
+
+	r.Start()
+	first := stopCh()
+	r.Start()
+	if first == nil || stopCh() != first {
+		t.Fatal("Start again should keep the running loop")
+	}
+	r.Stop()
+	r.Stop()
+	if stopCh() != nil {
+		t.Fatal("still running after Stop")
+	}
+	select {
+	case <-first:
+	default:
+		t.Error("stop channel not closed")
+	}
+
+	r.Start()
+	if ch := stopCh(); ch == nil || ch == first {
+		t.Error("not restarted")
+	}
+	r.Stop()
+	if r.Len() != 1 {
+		t.Errorf("buffer len = %d, want 1", r.Len())
+	}
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"github.com/lauthrul/goutil/log"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -8,28 +10,28 @@ import (
 	"time"
 )
 
-///*
-//{
-//   "code": 200,
-//   "name": "可乐",
-//   "artists_name": "赵紫骅",
-//   "music_url": "http:\/\/music.163.com\/song\/media\/outer\/url?id=29759733.mp3",
-//   "music_pic": "http:\/\/p4.music.126.net\/qOfVT6izV4mBe4IyQn489Q==\/18190320370401891.jpg",
-//   "avatarurl": "https:\/\/p1.music.126.net\/YB49c5avmPR0rzesWrdFOg==\/109951164057116045.jpg",
-//   "nickname": "為妳我受冷風吹i",
-//   "comments": "九寨沟地震的时候，她被埋在了木楼下面，用最后的力气给我发了一条短信，说如果我活着出来你会娶我吗？当时我就泪流满面。我会的我一定会的，后来被救了出来，只有微弱的呼吸，我跪着哭着给医生说一定要医好她啊，悲痛万分的是一直器官衰竭没有醒过来，到今天还是离开了我2018.2.2凌晨早晨9.30分。"
-//}
-//*/
-//type RandomInfo struct {
-//	Code        int    `json:"code"`
-//	Name        string `json:"name"`
-//	ArtistsName string `json:"artists_name"`
-//	MusicUrl    string `json:"music_url"`
-//	MusicPic    string `json:"music_pic"`
-//	AvatarUrl   string `json:"avatarurl"`
-//	NickName    string `json:"nickname"`
-//	Comments    string `json:"comments"`
-//}
+/*
+	{
+	   "code": 200,
+	   "name": "可乐",
+	   "artists_name": "赵紫骅",
+	   "music_url": "http:\/\/music.163.com\/song\/media\/outer\/url?id=29759733.mp3",
+	   "music_pic": "http:\/\/p4.music.126.net\/qOfVT6izV4mBe4IyQn489Q==\/18190320370401891.jpg",
+	   "avatarurl": "https:\/\/p1.music.126.net\/YB49c5avmPR0rzesWrdFOg==\/109951164057116045.jpg",
+	   "nickname": "為妳我受冷風吹i",
+	   "comments": "九寨沟地震的时候，她被埋在了木楼下面，用最后的力气给我发了一条短信，说如果我活着出来你会娶我吗？当时我就泪流满面。我会的我一定会的，后来被救了出来，只有微弱的呼吸，我跪着哭着给医生说一定要医好她啊，悲痛万分的是一直器官衰竭没有醒过来，到今天还是离开了我2018.2.2凌晨早晨9.30分。"
+	}
+*/
+type RandomInfo struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	ArtistsName string `json:"artists_name"`
+	MusicUrl    string `json:"music_url"`
+	MusicPic    string `json:"music_pic"`
+	AvatarUrl   string `json:"avatarurl"`
+	NickName    string `json:"nickname"`
+	Comments    string `json:"comments"`
+}
 
 type LinkInfo struct {
 	Code int    `json:"code"`
@@ -45,6 +47,7 @@ type CacheType uint
 const (
 	CachePic   CacheType = 1 << 0
 	CacheMusic           = 1 << 1
+	CacheLyric           = 1 << 2
 	CacheAll             = CachePic | CacheMusic
 )
 
@@ -61,6 +64,9 @@ var (
 		".wma": true,
 		".wav": true,
 	}
+	LyricExts = map[string]bool{
+		".lrc": true,
+	}
 )
 
 func CheckCaches(path, name string, typ CacheType) (map[CacheType]string, bool) {
@@ -69,6 +75,9 @@ func CheckCaches(path, name string, typ CacheType) (map[CacheType]string, bool)
 		fitTypes CacheType
 	)
 	_ = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
 		if strings.Index(info.Name(), name) >= 0 {
 			ext := filepath.Ext(info.Name())
 			if typ&CachePic == CachePic && PicExts[ext] {
@@ -79,6 +88,10 @@ func CheckCaches(path, name string, typ CacheType) (map[CacheType]string, bool)
 				res[CacheMusic] = path
 				fitTypes |= CacheMusic
 			}
+			if typ&CacheLyric == CacheLyric && LyricExts[ext] {
+				res[CacheLyric] = path
+				fitTypes |= CacheLyric
+			}
 		}
 		return nil
 	})
@@ -86,77 +99,129 @@ func CheckCaches(path, name string, typ CacheType) (map[CacheType]string, bool)
 	return res, fitTypes == typ
 }
 
+// 分段下载，通过OnDownloadProgress通知进度
 func Download(uri, split, fileName string) (string, error) {
-	data, _, err := HttpDoTimeout(nil, "GET", uri, nil, 30*time.Second)
-	if err != nil {
-		return "", err
-	}
 	name := uri[strings.LastIndex(uri, split)+1:]
 	if fileName != "" {
 		name = "cache/" + fileName + filepath.Ext(name)
 	}
-	err = ioutil.WriteFile(name, data, os.ModePerm)
-	return name, err
+	progress := DownloadProgress{Name: name, Url: uri}
+	data, err := downloadChunks(uri, &progress)
+	if err == nil {
+		err = ioutil.WriteFile(name, data, os.ModePerm)
+	}
+	progress.Done = true
+	if err != nil {
+		progress.Error = err.Error()
+		notifyDownload(progress)
+		return "", err
+	}
+	notifyDownload(progress)
+	return name, nil
+}
+
+// 加载封面，优先使用缓存
+func LoadPic(info *MusicInfo) error {
+	if info.MusicPicLocal != "" {
+		return nil
+	}
+	fileName := info.CacheName()
+	if res, ok := CheckCaches("cache", fileName, CachePic); ok {
+		info.MusicPicLocal = res[CachePic]
+		return nil
+	}
+	var err error
+	info.MusicPicLocal, err = Download(info.MusicPic, "/", fileName)
+	return err
+}
+
+// 获取歌曲真实地址
+func RequestLink(id string) (string, error) {
+	var linkInfo LinkInfo
+	data, err := HttpGetJson(fmt.Sprintf(LinkUrl, id), &linkInfo, 2*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if linkInfo.Code != 200 {
+		return "", codeError("link", linkInfo.Code, data)
+	}
+	return linkInfo.Data.Url, nil
 }
 
-//func RequestNext() (*Music, error) {
-//	var (
-//		randomInfo = new(RandomInfo)
-//		linkInfo   = new(LinkInfo)
-//		musicInfo  = new(Music)
-//	)
-//
-//	// get random randomInfo Info
-//	data, _, err := HttpDoTimeout(nil, "GET", RandomUrl, nil, 30*time.Second)
-//	if err != nil {
-//		return nil, err
-//	}
-//	err = json.Unmarshal(data, &randomInfo)
-//	if err != nil {
-//		return nil, err
-//	}
-//	if randomInfo.Code != 200 {
-//		return nil, fmt.Errorf("randomInfo http code err[%d]", randomInfo.Code)
-//	}
-//
-//	musicInfo.ID = randomInfo.MusicUrl[strings.LastIndex(randomInfo.MusicUrl, "=")+1 : strings.LastIndex(randomInfo.MusicUrl, ".mp3")]
-//	musicInfo.Name = randomInfo.Name
-//	musicInfo.ArtistsName = randomInfo.ArtistsName
-//	musicInfo.MusicPic = randomInfo.MusicPic
-//
-//	fileName := fmt.Sprintf("%s-%s", musicInfo.Name, musicInfo.ArtistsName)
-//
-//	if res, ok := CheckCaches("cache", fileName, CacheAll); ok {
-//		musicInfo.MusicPicLocal = res[CachePic]
-//		musicInfo.MusicLocal = res[CacheMusic]
-//		return musicInfo, nil
-//	}
-//
-//	// download music pic
-//	musicInfo.MusicPicLocal, err = Download(musicInfo.MusicPic, "/", fileName)
-//	if err != nil {
-//		return nil, err
-//	}
-//
-//	// download music
-//	data, _, err = HttpDoTimeout(nil, "GET", fmt.Sprintf(LinkUrl, musicInfo.ID), nil, 30*time.Second)
-//	if err != nil {
-//		return nil, err
-//	}
-//	err = json.Unmarshal(data, &linkInfo)
-//	if err != nil {
-//		return nil, err
-//	}
-//	if linkInfo.Code != 200 {
-//		return nil, fmt.Errorf("link http code err[%d]", linkInfo.Code)
-//	}
-//	musicInfo.MusicUrl = linkInfo.Data.Url
-//	musicInfo.MusicLocal, err = Download(musicInfo.MusicUrl, "/", fileName)
-//	if err != nil {
-//		return nil, err
-//	}
-//
-//	log.DebugF("%+v, err: %v\n", musicInfo, err)
-//
-//	return musicInfo, err
-//}
+// 加载歌曲，优先使用缓存，否则获取真实地址并下载
+func LoadMusic(info *MusicInfo) error {
+	if info.MusicLocal != "" {
+		return nil
+	}
+	fileName := info.CacheName()
+	if res, ok := CheckCaches("cache", fileName, CacheMusic); ok {
+		info.MusicLocal = res[CacheMusic]
+		return nil
+	}
+	var err error
+	if info.MusicUrl == "" {
+		info.MusicUrl, err = RequestLink(info.ID)
+		if err != nil {
+			return err
+		}
+	}
+	info.MusicLocal, err = Download(info.MusicUrl, "/", fileName)
+	return err
+}
+
+// 随机获取一首歌曲，两个接口互为备用
+func RequestRandom() (*RandomInfo, error) {
+	var lastErr error
+	for _, uri := range []string{RandomUrl, RandomUrl2} {
+		var randomInfo RandomInfo
+		data, err := HttpGetJson(uri, &randomInfo, 30*time.Second)
+		if err == nil && randomInfo.Code != 200 {
+			err = fmt.Errorf("random http code err[%d]: %s", randomInfo.Code, string(data))
+		}
+		if err == nil && randomInfo.MusicUrl == "" {
+			err = fmt.Errorf("random music url empty: %s", string(data))
+		}
+		if err != nil {
+			log.Error(uri, err)
+			lastErr = err
+			continue
+		}
+		return &randomInfo, nil
+	}
+	return nil, lastErr
+}
+
+func RequestNext() (*Music, error) {
+	randomInfo, err := RequestRandom()
+	if err != nil {
+		return nil, err
+	}
+	music := &Music{Info: randomInfo.MusicInfo()}
+	if err = LoadPic(&music.Info); err != nil {
+		return nil, err
+	}
+	if err = LoadMusic(&music.Info); err != nil {
+		return nil, err
+	}
+
+	log.DebugF("%+v, err: %v\n", music.Info, err)
+
+	return music, nil
+}
+
+func (r *RandomInfo) MusicInfo() MusicInfo {
+	// http://music.163.com/song/media/outer/url?id=29759733.mp3
+	id := r.MusicUrl[strings.LastIndex(r.MusicUrl, "=")+1:]
+	id = strings.TrimSuffix(id, ".mp3")
+	return MusicInfo{
+		ID:          id,
+		Name:        r.Name,
+		ArtistsName: r.ArtistsName,
+		MusicPic:    r.MusicPic,
+		Featured: &FeaturedComment{
+			NickName:  r.NickName,
+			AvatarUrl: r.AvatarUrl,
+			Comments:  r.Comments,
+		},
+	}
+}
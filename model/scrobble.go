@@ -0,0 +1,377 @@
+package model
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	scrobbleConfigFile = "scrobble.json"
+	scrobbleQueueFile  = "scrobble_queue.json"
+
+	ScrobbleMinDuration = 30 * time.Second    // 短于30秒的歌曲不记录
+	ScrobbleMaxAge      = 14 * 24 * time.Hour // 服务端不接受过旧的记录
+)
+
+type Scrobble struct {
+	Service   string    `json:"service"`
+	Info      MusicInfo `json:"info"`
+	Timestamp time.Time `json:"timestamp"` // 开始播放时间
+	Attempts  int       `json:"attempts"`
+}
+
+type Scrobbler interface {
+	Name() string
+	NowPlaying(info MusicInfo) error
+	Scrobble(s Scrobble) error
+}
+
+func checkScrobbleResp(service string, data []byte, code int, err error) error {
+	if err != nil {
+		return err
+	}
+	if code != 200 {
+		return fmt.Errorf("%s http status err[%d]: %s", service, code, string(data))
+	}
+	return nil
+}
+
+// ListenBrainz JSON API
+type ListenBrainz struct {
+	BaseUrl string `json:"base_url"`
+	Token   string `json:"token"`
+}
+
+func (lb *ListenBrainz) Name() string {
+	return "listenbrainz"
+}
+
+func (lb *ListenBrainz) submit(listenType string, info MusicInfo, at time.Time) error {
+	type additionalInfo struct {
+		DurationMs  int64  `json:"duration_ms,omitempty"`
+		MediaPlayer string `json:"media_player"`
+		OriginUrl   string `json:"origin_url,omitempty"`
+	}
+	type trackMetadata struct {
+		ArtistName     string         `json:"artist_name"`
+		TrackName      string         `json:"track_name"`
+		ReleaseName    string         `json:"release_name,omitempty"`
+		AdditionalInfo additionalInfo `json:"additional_info"`
+	}
+	type listen struct {
+		ListenedAt    int64         `json:"listened_at,omitempty"`
+		TrackMetadata trackMetadata `json:"track_metadata"`
+	}
+	body := struct {
+		ListenType string   `json:"listen_type"`
+		Payload    []listen `json:"payload"`
+	}{ListenType: listenType}
+
+	l := listen{TrackMetadata: trackMetadata{
+		ArtistName:  info.ArtistsName,
+		TrackName:   info.Name,
+		ReleaseName: info.AlbumName,
+		AdditionalInfo: additionalInfo{
+			DurationMs:  info.Duration.Milliseconds(),
+			MediaPlayer: "wander",
+		},
+	}}
+	if info.ID != "" {
+		l.TrackMetadata.AdditionalInfo.OriginUrl = "https://music.163.com/song?id=" + info.ID
+	}
+	if !at.IsZero() {
+		l.ListenedAt = at.Unix()
+	}
+	body.Payload = append(body.Payload, l)
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	baseUrl := lb.BaseUrl
+	if baseUrl == "" {
+		baseUrl = ListenBrainzUrl
+	}
+	headers := map[string]string{
+		"Authorization": "Token " + lb.Token,
+		"Content-Type":  "application/json",
+	}
+	resp, code, err := HttpDoTimeout(data, "POST", strings.TrimRight(baseUrl, "/")+"/1/submit-listens", headers, 30*time.Second)
+	return checkScrobbleResp(lb.Name(), resp, code, err)
+}
+
+func (lb *ListenBrainz) NowPlaying(info MusicInfo) error {
+	return lb.submit("playing_now", info, time.Time{})
+}
+
+func (lb *ListenBrainz) Scrobble(s Scrobble) error {
+	return lb.submit("single", s.Info, s.Timestamp)
+}
+
+// Last.fm 2.0 API，需要已授权的session key
+type LastFm struct {
+	BaseUrl    string `json:"base_url"`
+	ApiKey     string `json:"api_key"`
+	Secret     string `json:"secret"`
+	SessionKey string `json:"session_key"`
+}
+
+func (lf *LastFm) Name() string {
+	return "lastfm"
+}
+
+// api_sig为按参数名排序后拼接的key+value再加上secret的md5
+func (lf *LastFm) sign(params url.Values) string {
+	var keys []string
+	for k := range params {
+		if k != "format" && k != "callback" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k + params.Get(k))
+	}
+	sb.WriteString(lf.Secret)
+	sum := md5.Sum([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (lf *LastFm) call(method string, params url.Values) error {
+	params.Set("method", method)
+	params.Set("api_key", lf.ApiKey)
+	params.Set("sk", lf.SessionKey)
+	params.Set("api_sig", lf.sign(params))
+	params.Set("format", "json")
+
+	baseUrl := lf.BaseUrl
+	if baseUrl == "" {
+		baseUrl = LastFmUrl
+	}
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	data, code, err := HttpDoTimeout([]byte(params.Encode()), "POST", baseUrl, headers, 30*time.Second)
+	if err = checkScrobbleResp(lf.Name(), data, code, err); err != nil {
+		return err
+	}
+	var resp struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &resp) == nil && resp.Error != 0 {
+		return fmt.Errorf("lastfm err[%d]: %s", resp.Error, resp.Message)
+	}
+	return nil
+}
+
+func lastFmTrackParams(info MusicInfo) url.Values {
+	params := url.Values{}
+	params.Set("artist", info.ArtistsName)
+	params.Set("track", info.Name)
+	if info.AlbumName != "" {
+		params.Set("album", info.AlbumName)
+	}
+	if info.Duration > 0 {
+		params.Set("duration", fmt.Sprintf("%d", int(info.Duration.Seconds())))
+	}
+	return params
+}
+
+func (lf *LastFm) NowPlaying(info MusicInfo) error {
+	return lf.call("track.updateNowPlaying", lastFmTrackParams(info))
+}
+
+func (lf *LastFm) Scrobble(s Scrobble) error {
+	params := lastFmTrackParams(s.Info)
+	params.Set("timestamp", fmt.Sprintf("%d", s.Timestamp.Unix()))
+	return lf.call("track.scrobble", params)
+}
+
+type ScrobbleConfig struct {
+	ListenBrainz *ListenBrainz `json:"listenbrainz,omitempty"`
+	LastFm       *LastFm       `json:"lastfm,omitempty"`
+}
+
+// 读取data/scrobble.json，未配置时返回空
+func LoadScrobblers() ([]Scrobbler, error) {
+	var (
+		cfg        ScrobbleConfig
+		scrobblers []Scrobbler
+	)
+	err := loadJson(scrobbleConfigFile, &cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ListenBrainz != nil && cfg.ListenBrainz.Token != "" {
+		scrobblers = append(scrobblers, cfg.ListenBrainz)
+	}
+	if cfg.LastFm != nil && cfg.LastFm.SessionKey != "" {
+		scrobblers = append(scrobblers, cfg.LastFm)
+	}
+	return scrobblers, nil
+}
+
+// 上报正在播放及播放记录，网络不可用时保存到离线队列稍后重试
+type ScrobbleManager struct {
+	scrobblers map[string]Scrobbler
+	playing    chan MusicInfo // 待上报的正在播放，只保留最新一首
+
+	mu    sync.Mutex
+	queue []Scrobble
+}
+
+func NewScrobbleManager(scrobblers ...Scrobbler) (*ScrobbleManager, error) {
+	m := &ScrobbleManager{scrobblers: map[string]Scrobbler{}, playing: make(chan MusicInfo, 1)}
+	for _, s := range scrobblers {
+		m.scrobblers[s.Name()] = s
+	}
+	err := loadStore(scrobbleQueueFile, &m.queue)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return m, err
+}
+
+func (m *ScrobbleManager) saveQueue() error {
+	return saveJson(scrobbleQueueFile, m.queue)
+}
+
+// 处理播放回调，并定时重试离线队列
+func (m *ScrobbleManager) Run(ch <-chan PlayCallback) {
+	go m.reportNowPlaying()
+	go func() {
+		defer close(m.playing)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		m.Flush()
+		for {
+			select {
+			case cb, ok := <-ch:
+				if !ok {
+					return
+				}
+				m.handle(cb)
+			case <-ticker.C:
+				m.Flush()
+			}
+		}
+	}()
+}
+
+// 正在播放只是状态提示，在后台尽力上报，不影响播放记录的处理
+func (m *ScrobbleManager) reportNowPlaying() {
+	for info := range m.playing {
+		for _, s := range m.scrobblers {
+			if err := s.NowPlaying(info); err != nil {
+				log.Error(s.Name(), "now playing err:", err)
+			}
+		}
+	}
+}
+
+// 替换还未上报的正在播放
+func (m *ScrobbleManager) nowPlaying(info MusicInfo) {
+	for {
+		select {
+		case m.playing <- info:
+			return
+		default:
+		}
+		select {
+		case <-m.playing:
+		default:
+		}
+	}
+}
+
+func (m *ScrobbleManager) handle(cb PlayCallback) {
+	switch cb.Action {
+	case ActionPlay:
+		m.nowPlaying(cb.Info)
+	case ActionRecord:
+		rec := cb.Record
+		if !rec.Counted || rec.Duration < ScrobbleMinDuration {
+			return
+		}
+		info := cb.Info
+		info.Duration = rec.Duration
+		for name := range m.scrobblers {
+			m.Submit(Scrobble{Service: name, Info: info, Timestamp: rec.Start})
+		}
+	}
+}
+
+// 提交一条记录，失败时加入离线队列
+func (m *ScrobbleManager) Submit(s Scrobble) {
+	scrobbler := m.scrobblers[s.Service]
+	if scrobbler == nil {
+		return
+	}
+	if err := scrobbler.Scrobble(s); err != nil {
+		log.Error(s.Service, "scrobble err, queued:", err)
+		s.Attempts++
+		m.mu.Lock()
+		m.queue = append(m.queue, s)
+		if err = m.saveQueue(); err != nil {
+			log.Error("save scrobble queue err:", err)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// 重试离线队列，返回剩余条数
+func (m *ScrobbleManager) Flush() int {
+	m.mu.Lock()
+	queue := m.queue
+	m.queue = nil
+	m.mu.Unlock()
+	if len(queue) == 0 {
+		return 0
+	}
+
+	var (
+		remain []Scrobble
+		failed = map[string]bool{} // 某服务失败后本轮不再重试该服务
+	)
+	for _, s := range queue {
+		if time.Since(s.Timestamp) > ScrobbleMaxAge || m.scrobblers[s.Service] == nil {
+			continue
+		}
+		if failed[s.Service] {
+			remain = append(remain, s)
+			continue
+		}
+		if err := m.scrobblers[s.Service].Scrobble(s); err != nil {
+			failed[s.Service] = true
+			s.Attempts++
+			remain = append(remain, s)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(remain, m.queue...)
+	if err := m.saveQueue(); err != nil {
+		log.Error("save scrobble queue err:", err)
+	}
+	return len(m.queue)
+}
+
+func (m *ScrobbleManager) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.queue)
+}
@@ -0,0 +1,242 @@
+package model
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录收到的请求，fail为true时返回503
+type scrobbleServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	fail   bool
+	bodies []string
+	header []http.Header
+}
+
+func newScrobbleServer(t *testing.T) *scrobbleServer {
+	s := &scrobbleServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.bodies = append(s.bodies, string(data))
+		s.header = append(s.header, r.Header.Clone())
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scrobbleServer) setFail(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+func (s *scrobbleServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.bodies...)
+}
+
+func testScrobbleInfo() MusicInfo {
+	return MusicInfo{ID: "186016", Name: "晴天", ArtistsName: "周杰伦", AlbumName: "叶惠美", Duration: 269 * time.Second}
+}
+
+func TestListenBrainzScrobble(t *testing.T) {
+	srv := newScrobbleServer(t)
+	lb := &ListenBrainz{BaseUrl: srv.URL + "/", Token: "secret"}
+	at := time.Unix(1700000000, 0)
+	if err := lb.Scrobble(Scrobble{Service: lb.Name(), Info: testScrobbleInfo(), Timestamp: at}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lb.NowPlaying(testScrobbleInfo()); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := srv.received()
+	if len(bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(bodies))
+	}
+	if got := srv.header[0].Get("Authorization"); got != "Token secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	var body struct {
+		ListenType string `json:"listen_type"`
+		Payload    []struct {
+			ListenedAt    int64 `json:"listened_at"`
+			TrackMetadata struct {
+				ArtistName     string `json:"artist_name"`
+				TrackName      string `json:"track_name"`
+				ReleaseName    string `json:"release_name"`
+				AdditionalInfo struct {
+					DurationMs int64 `json:"duration_ms"`
+				} `json:"additional_info"`
+			} `json:"track_metadata"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ListenType != "single" || len(body.Payload) != 1 {
+		t.Fatalf("unexpected body: %s", bodies[0])
+	}
+	meta := body.Payload[0].TrackMetadata
+	if body.Payload[0].ListenedAt != at.Unix() || meta.TrackName != "晴天" || meta.ArtistName != "周杰伦" ||
+		meta.ReleaseName != "叶惠美" || meta.AdditionalInfo.DurationMs != 269000 {
+		t.Errorf("unexpected listen: %s", bodies[0])
+	}
+
+	body.Payload = nil
+	if err := json.Unmarshal([]byte(bodies[1]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ListenType != "playing_now" || body.Payload[0].ListenedAt != 0 {
+		t.Errorf("unexpected now playing: %s", bodies[1])
+	}
+}
+
+func TestLastFmScrobble(t *testing.T) {
+	srv := newScrobbleServer(t)
+	lf := &LastFm{BaseUrl: srv.URL, ApiKey: "key", Secret: "sec", SessionKey: "sk"}
+	at := time.Unix(1700000000, 0)
+	if err := lf.Scrobble(Scrobble{Service: lf.Name(), Info: testScrobbleInfo(), Timestamp: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := srv.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(bodies))
+	}
+	params, err := url.ParseQuery(bodies[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"method": "track.scrobble", "api_key": "key", "sk": "sk", "format": "json",
+		"artist": "周杰伦", "track": "晴天", "album": "叶惠美", "duration": "269", "timestamp": "1700000000",
+	}
+	for k, v := range want {
+		if got := params.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	sig := params.Get("api_sig")
+	params.Del("api_sig")
+	if want := lf.sign(params); sig != want {
+		t.Errorf("api_sig = %q, want %q", sig, want)
+	}
+}
+
+func TestLastFmError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error":9,"message":"Invalid session key"}`))
+	}))
+	defer srv.Close()
+	lf := &LastFm{BaseUrl: srv.URL, ApiKey: "key", Secret: "sec", SessionKey: "sk"}
+	if err := lf.NowPlaying(testScrobbleInfo()); err == nil {
+		t.Error("expected error for lastfm error response")
+	}
+}
+
+func TestScrobbleOfflineQueue(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	lbSrv, lfSrv := newScrobbleServer(t), newScrobbleServer(t)
+	lbSrv.setFail(true)
+	lfSrv.setFail(true)
+	lb := &ListenBrainz{BaseUrl: lbSrv.URL, Token: "secret"}
+	lf := &LastFm{BaseUrl: lfSrv.URL, ApiKey: "key", Secret: "sec", SessionKey: "sk"}
+	m, err := NewScrobbleManager(lb, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := testScrobbleInfo()
+	m.Submit(Scrobble{Service: lb.Name(), Info: info, Timestamp: time.Now()})
+	m.Submit(Scrobble{Service: lf.Name(), Info: info, Timestamp: time.Now()})
+	// 过旧的记录重试时丢弃
+	m.Submit(Scrobble{Service: lb.Name(), Info: info, Timestamp: time.Now().Add(-ScrobbleMaxAge - time.Hour)})
+	if n := m.Pending(); n != 3 {
+		t.Fatalf("pending = %d, want 3", n)
+	}
+
+	// 队列保存在数据目录中，重新启动后继续重试
+	m, err = NewScrobbleManager(lb, lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := m.Pending(); n != 3 {
+		t.Fatalf("pending after reload = %d, want 3", n)
+	}
+	if n := m.Flush(); n != 2 {
+		t.Fatalf("remain after failed flush = %d, want 2", n)
+	}
+	for _, s := range m.queue {
+		if s.Attempts != 2 {
+			t.Errorf("%s attempts = %d, want 2", s.Service, s.Attempts)
+		}
+	}
+
+	lbSrv.setFail(false)
+	lfSrv.setFail(false)
+	if n := m.Flush(); n != 0 {
+		t.Fatalf("remain after flush = %d, want 0", n)
+	}
+	if len(lbSrv.received()) != 1 || len(lfSrv.received()) != 1 {
+		t.Errorf("received %d listenbrainz and %d lastfm scrobbles, want 1 each", len(lbSrv.received()), len(lfSrv.received()))
+	}
+}
+
+// 记录超过阈值才上报，正在播放在后台上报
+func TestScrobbleManagerRun(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	srv := newScrobbleServer(t)
+	m, err := NewScrobbleManager(&ListenBrainz{BaseUrl: srv.URL, Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan PlayCallback)
+	m.Run(ch)
+
+	music := Music{Info: testScrobbleInfo()}
+	ch <- PlayCallback{Music: music, Action: ActionPlay}
+	ch <- PlayCallback{Music: music, Action: ActionRecord, Record: PlayRecord{Start: time.Now(), Duration: 269 * time.Second, Counted: false}}
+	ch <- PlayCallback{Music: music, Action: ActionRecord, Record: PlayRecord{Start: time.Now(), Duration: 269 * time.Second, Counted: true}}
+	close(ch)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var single, playing int
+	for _, body := range srv.received() {
+		var v struct {
+			ListenType string `json:"listen_type"`
+		}
+		json.Unmarshal([]byte(body), &v)
+		switch v.ListenType {
+		case "single":
+			single++
+		case "playing_now":
+			playing++
+		}
+	}
+	if single != 1 || playing != 1 {
+		t.Errorf("got %d scrobbles and %d now playing, want 1 each", single, playing)
+	}
+}
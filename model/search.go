@@ -0,0 +1,152 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type SearchType int
+
+const (
+	SearchSong     SearchType = 1
+	SearchAlbum    SearchType = 10
+	SearchArtist   SearchType = 100
+	SearchPlaylist SearchType = 1000
+)
+
+const DefaultSearchLimit = 30
+
+// 搜索类型的名称，用于命令行及接口参数
+var SearchTypeNames = map[string]SearchType{
+	"song":     SearchSong,
+	"album":    SearchAlbum,
+	"artist":   SearchArtist,
+	"playlist": SearchPlaylist,
+}
+
+type SearchResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Songs     []TrackResp `json:"songs"`
+		SongCount int         `json:"songCount"`
+		Artists   []struct {
+			ID        int    `json:"id"`
+			Name      string `json:"name"`
+			PicUrl    string `json:"picUrl"`
+			AlbumSize int    `json:"albumSize"`
+		} `json:"artists"`
+		ArtistCount int `json:"artistCount"`
+		Albums      []struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			PicUrl string `json:"picUrl"`
+			Size   int    `json:"size"`
+			Artist struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+		} `json:"albums"`
+		AlbumCount int `json:"albumCount"`
+		Playlists  []struct {
+			ID          int    `json:"id"`
+			Name        string `json:"name"`
+			CoverImgUrl string `json:"coverImgUrl"`
+			TrackCount  int    `json:"trackCount"`
+			Creator     struct {
+				Nickname string `json:"nickname"`
+			} `json:"creator"`
+		} `json:"playlists"`
+		PlaylistCount int `json:"playlistCount"`
+	} `json:"data"`
+}
+
+// 歌手、专辑、歌单的搜索结果
+type SearchItem struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Pic   string `json:"pic"`
+	Owner string `json:"owner"` // 专辑歌手 / 歌单创建者
+	Size  int    `json:"size"`  // 专辑数 / 歌曲数
+}
+
+type SearchResult struct {
+	Type   SearchType
+	Page   int
+	Limit  int
+	Total  int // 命中总数，用于分页
+	Musics []*Music
+	Items  []SearchItem
+}
+
+func (r *SearchResult) Pages() int {
+	if r.Limit <= 0 {
+		return 0
+	}
+	return (r.Total + r.Limit - 1) / r.Limit
+}
+
+func (r *SearchResult) HasMore() bool {
+	return r.Page+1 < r.Pages()
+}
+
+// page从0开始
+func Search(keyword string, typ SearchType, page, limit int) (*SearchResult, error) {
+	if keyword == "" {
+		return nil, fmt.Errorf("empty keyword")
+	}
+	switch typ {
+	case SearchSong, SearchAlbum, SearchArtist, SearchPlaylist:
+	default:
+		return nil, fmt.Errorf("unknown search type: %d", typ)
+	}
+	if page < 0 {
+		page = 0
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	var resp SearchResp
+	uri := fmt.Sprintf(SearchUrl, url.QueryEscape(keyword), typ, limit, page*limit)
+	data, err := HttpGetJson(uri, &resp, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != 200 {
+		return nil, codeError("search", resp.Code, data)
+	}
+
+	res := &SearchResult{Type: typ, Page: page, Limit: limit}
+	switch typ {
+	case SearchSong:
+		res.Total = resp.Data.SongCount
+		res.Musics = WalkTracks(resp.Data.Songs)
+	case SearchArtist:
+		res.Total = resp.Data.ArtistCount
+		for _, a := range resp.Data.Artists {
+			res.Items = append(res.Items, SearchItem{ID: fmt.Sprintf("%d", a.ID), Name: a.Name, Pic: a.PicUrl, Size: a.AlbumSize})
+		}
+	case SearchAlbum:
+		res.Total = resp.Data.AlbumCount
+		for _, a := range resp.Data.Albums {
+			res.Items = append(res.Items, SearchItem{ID: fmt.Sprintf("%d", a.ID), Name: a.Name, Pic: a.PicUrl, Owner: a.Artist.Name, Size: a.Size})
+		}
+	case SearchPlaylist:
+		res.Total = resp.Data.PlaylistCount
+		for _, p := range resp.Data.Playlists {
+			res.Items = append(res.Items, SearchItem{ID: fmt.Sprintf("%d", p.ID), Name: p.Name, Pic: p.CoverImgUrl, Owner: p.Creator.Nickname, Size: p.TrackCount})
+		}
+	default:
+		return nil, fmt.Errorf("unknown search type[%d]", typ)
+	}
+	return res, nil
+}
+
+func SearchMusic(keyword string, page, limit int) ([]*Music, int, error) {
+	res, err := Search(keyword, SearchSong, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return res.Musics, res.Total, nil
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+// 未知的搜索类型不发起请求
+func TestSearchUnknownType(t *testing.T) {
+	res, err := Search("晴天", SearchType(2), 0, 10)
+	if err == nil || !strings.Contains(err.Error(), "unknown search type") {
+		t.Errorf("Search = %v, %v, want unknown search type", res, err)
+	}
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const sessionFile = "session.json"
+
+// 定时保存的间隔
+const SessionSaveInterval = 10 * time.Second
+
+// 播放状态，启动时恢复
+type Session struct {
+	Playlist string        `json:"playlist"` // 选中的歌单ID
+	Queue    []MusicInfo   `json:"queue"`
+	Index    int           `json:"index"`    // 当前歌曲在Queue中的位置
+	Pos      int           `json:"pos"`      // 当前播放位置，采样数
+	Position time.Duration `json:"position"` // 当前播放位置，用于显示
+	Mode     PlayMode      `json:"mode"`
+	Volume   int           `json:"volume"`
+	Saved    time.Time     `json:"saved"`
+}
+
+// 读取上次保存的播放状态，没有时返回nil
+func LoadSession() (*Session, error) {
+	var s Session
+	err := loadJson(sessionFile, &s)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Index >= len(s.Queue) {
+		s.Index = len(s.Queue) - 1
+	}
+	return &s, nil
+}
+
+func SaveSession(s *Session) error {
+	s.Saved = time.Now()
+	return saveJson(sessionFile, s)
+}
+
+func (s *Session) Musics() []*Music {
+	var musics []*Music
+	for _, info := range s.Queue {
+		musics = append(musics, &Music{Info: info, Source: s.Playlist})
+	}
+	return musics
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 本地数据目录，存放歌单、收藏等用户数据
+var DataDir = "data"
+
+// 数据文件损坏，已改名备份
+type CorruptError struct {
+	Name   string
+	Backup string
+	Err    error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%s corrupt, moved to %s: %v", e.Name, e.Backup, e.Err)
+}
+func (e *CorruptError) Unwrap() error { return e.Err }
+
+var (
+	unreadableMu sync.Mutex
+	unreadable   = map[string]error{} // 无法读取也无法备份的数据文件，不允许覆盖
+)
+
+func dataPath(name string) string {
+	return filepath.Join(DataDir, name)
+}
+
+// 读取json数据文件，文件不存在时返回os.ErrNotExist
+func loadJson(name string, v interface{}) error {
+	data, err := ioutil.ReadFile(dataPath(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// 读取会被写回的数据文件，如歌单、收藏。
+// 内容损坏时改名为name.corrupt-时间后返回CorruptError，之后保存不会覆盖原来的数据；
+// 无法读取或备份时返回错误，并拒绝保存该文件
+func loadStore(name string, v interface{}) error {
+	err := loadJson(name, v)
+	unreadableMu.Lock()
+	defer unreadableMu.Unlock()
+	delete(unreadable, name)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+		unreadable[name] = err
+		return err
+	}
+	backup := fmt.Sprintf("%s.corrupt-%s", dataPath(name), time.Now().Format("20060102150405"))
+	if renameErr := os.Rename(dataPath(name), backup); renameErr != nil {
+		log.Error("backup corrupt data file err:", renameErr)
+		unreadable[name] = err
+		return err
+	}
+	return &CorruptError{Name: name, Backup: backup, Err: err}
+}
+
+func saveJson(name string, v interface{}) error {
+	unreadableMu.Lock()
+	loadErr := unreadable[name]
+	unreadableMu.Unlock()
+	if loadErr != nil {
+		return fmt.Errorf("%s was not loaded, refuse to overwrite: %w", name, loadErr)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(DataDir, os.ModePerm); err != nil {
+		return err
+	}
+	return WriteFileAtomic(dataPath(name), data)
+}
+
+// 先写入同目录下的临时文件再重命名，避免写入中途崩溃导致文件损坏
+func WriteFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
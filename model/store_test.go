@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCorruptStoreBackedUp(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	corrupt := []byte(`[{"id": "my", "name": "我的歌单"`)
+	if err := ioutil.WriteFile(dataPath(playlistStoreFile), corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewPlaylistStore()
+	var ce *CorruptError
+	if !errors.As(err, &ce) {
+		t.Fatalf("err = %v, want CorruptError", err)
+	}
+	if data, err := ioutil.ReadFile(ce.Backup); err != nil || string(data) != string(corrupt) {
+		t.Errorf("backup %s = %q, %v", ce.Backup, data, err)
+	}
+	if len(s.List()) < len(DefaultCharts) {
+		t.Errorf("got %d playlists, want default charts", len(s.List()))
+	}
+
+	// 备份后重新加载得到新保存的内容
+	if _, err = NewPlaylistStore(); err != nil {
+		t.Errorf("reload err = %v", err)
+	}
+}
+
+func TestUnreadableStoreNotOverwritten(t *testing.T) {
+	DataDir = t.TempDir()
+	defer func() { DataDir = "data" }()
+
+	// 用目录代替文件，读取和改名都无法得到有效数据
+	if err := os.MkdirAll(filepath.Join(dataPath(favoriteStoreFile), "x"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFavoriteStore()
+	if err == nil {
+		t.Fatal("expected load error")
+	}
+	if _, err = f.ToggleFavorite(MusicInfo{ID: "1", Name: "a"}); err == nil {
+		t.Error("expected save to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(dataPath(favoriteStoreFile), "x")); err != nil {
+		t.Errorf("original data removed: %v", err)
+	}
+}
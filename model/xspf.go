@@ -0,0 +1,168 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	xspfNamespace = "http://xspf.org/ns/0/"
+	xspfWanderUri = "wander:" // identifier格式 wander:provider:id
+)
+
+type XSPFTrack struct {
+	Location   string `xml:"location,omitempty"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	Annotation string `xml:"annotation,omitempty"`
+	Image      string `xml:"image,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"` // 毫秒
+	TrackNum   int    `xml:"trackNum,omitempty"`
+}
+
+type XSPFPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []XSPFTrack `xml:"trackList>track"`
+}
+
+// xspf的location为URI，本地文件使用file://
+// Windows路径前加/，写成file:///C:/...，否则盘符会被当作主机名
+func xspfLocation(location string) string {
+	if location == "" || isRemote(location) {
+		return location
+	}
+	if hasDriveLetter(location) {
+		return (&url.URL{Scheme: "file", Path: "/" + location}).String()
+	}
+	if filepath.IsAbs(filepath.FromSlash(location)) {
+		return (&url.URL{Scheme: "file", Path: location}).String()
+	}
+	return (&url.URL{Path: location}).String()
+}
+
+func xspfPath(location string) string {
+	if isRemote(location) {
+		return location
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	if strings.HasPrefix(u.Path, "/") && hasDriveLetter(u.Path[1:]) {
+		return u.Path[1:]
+	}
+	return u.Path
+}
+
+// 是否以Windows盘符开头，如C:或C:/
+func hasDriveLetter(path string) bool {
+	if len(path) < 2 || path[1] != ':' {
+		return false
+	}
+	c := path[0]
+	return ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && (len(path) == 2 || path[2] == '/' || path[2] == '\\')
+}
+
+func WriteXSPF(w io.Writer, title string, infos []MusicInfo, opts PlaylistFileOptions) error {
+	playlist := XSPFPlaylist{Xmlns: xspfNamespace, Version: "1", Title: title}
+	for _, info := range infos {
+		track := XSPFTrack{
+			Location: xspfLocation(trackLocation(info, opts)),
+			Title:    info.Name,
+			Creator:  info.ArtistsName,
+			Album:    info.AlbumName,
+			Image:    info.MusicPic,
+			Duration: info.Duration.Milliseconds(),
+			TrackNum: info.TrackNo,
+		}
+		if info.ID != "" {
+			track.Identifier = xspfWanderUri + ProviderNetease + ":" + info.ID
+		}
+		if info.Featured != nil {
+			track.Annotation = info.Featured.Comments
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(playlist); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func ReadXSPF(r io.Reader, opts PlaylistFileOptions) (*ImportResult, error) {
+	var playlist XSPFPlaylist
+	if err := xml.NewDecoder(r).Decode(&playlist); err != nil {
+		return nil, &DecodeError{err}
+	}
+	res := &ImportResult{}
+	for i, track := range playlist.Tracks {
+		info := MusicInfo{
+			Name:        track.Title,
+			ArtistsName: track.Creator,
+			AlbumName:   track.Album,
+			Duration:    time.Duration(track.Duration) * time.Millisecond,
+			TrackNo:     track.TrackNum,
+		}
+		if isRemote(track.Image) {
+			info.MusicPic = track.Image
+		} else if track.Image != "" {
+			info.MusicPicLocal = xspfPath(track.Image)
+		}
+		if track.Annotation != "" {
+			info.Featured = &FeaturedComment{Comments: track.Annotation}
+		}
+		provider := ""
+		if strings.HasPrefix(track.Identifier, xspfWanderUri) {
+			parts := strings.SplitN(strings.TrimPrefix(track.Identifier, xspfWanderUri), ":", 2)
+			if len(parts) == 2 {
+				provider, info.ID = parts[0], parts[1]
+			}
+		}
+		if resolveTrack(&info, provider, xspfPath(track.Location), opts) {
+			res.Musics = append(res.Musics, info)
+			continue
+		}
+		entry := track.Location
+		if entry == "" {
+			entry = fmt.Sprintf("#%d %s - %s", i+1, track.Creator, track.Title)
+		}
+		res.Unresolved = append(res.Unresolved, entry)
+	}
+	return res, nil
+}
+
+func ImportXSPF(path string) (*ImportResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadXSPF(f, PlaylistFileOptions{BaseDir: filepath.Dir(path)})
+}
+
+func ExportXSPF(path, title string, infos []MusicInfo, relative bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteXSPF(f, title, infos, PlaylistFileOptions{BaseDir: filepath.Dir(path), Relative: relative})
+}
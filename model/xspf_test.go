@@ -0,0 +1,22 @@
+package model
+
+import "testing"
+
+func TestXSPFLocation(t *testing.T) {
+	tests := []struct {
+		path, location string
+	}{
+		{"C:/Music/a b.mp3", "file:///C:/Music/a%20b.mp3"},
+		{"/home/u/Music/晴天.mp3", "file:///home/u/Music/%E6%99%B4%E5%A4%A9.mp3"},
+		{"music/a#1.mp3", "music/a%231.mp3"},
+		{"https://music.163.com/song?id=1", "https://music.163.com/song?id=1"},
+	}
+	for _, tt := range tests {
+		if got := xspfLocation(tt.path); got != tt.location {
+			t.Errorf("xspfLocation(%q) = %q, want %q", tt.path, got, tt.location)
+		}
+		if got := xspfPath(tt.location); got != tt.path {
+			t.Errorf("xspfPath(%q) = %q, want %q", tt.location, got, tt.path)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package presenter
+
+import "wander/model"
+
+func (p *Presenter) IsFavorite(id string) bool {
+	return p.favorites != nil && p.favorites.IsFavorite(id)
+}
+
+func (p *Presenter) IsBlocked(info model.MusicInfo) bool {
+	return p.blocklist != nil && p.blocklist.IsBlocked(info)
+}
+
+// 选中歌曲的信息，没有选中时ok为false
+func (p *Presenter) selected() (info model.MusicInfo, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if music := p.state.Selected(); music != nil {
+		return music.Info, true
+	}
+	return info, false
+}
+
+// 收藏或取消收藏选中的歌曲
+func (p *Presenter) ToggleFavorite() {
+	info, ok := p.selected()
+	if !ok {
+		return
+	}
+	if _, err := p.favorites.ToggleFavorite(info); err != nil {
+		p.fail(err)
+		return
+	}
+	p.emit(ChangeTracks | ChangeSelection)
+}
+
+// 屏蔽选中的歌曲
+func (p *Presenter) BlockTrack() {
+	if info, ok := p.selected(); ok {
+		p.afterBlock(p.blocklist.BlockTrack(info))
+	}
+}
+
+// 屏蔽选中歌曲的歌手
+func (p *Presenter) BlockArtist() {
+	if info, ok := p.selected(); ok {
+		p.afterBlock(p.blocklist.BlockArtist(info.ArtistsName))
+	}
+}
+
+// 撤销最近一次屏蔽或解除屏蔽
+func (p *Presenter) UndoBlock() {
+	entry, err := p.blocklist.Undo()
+	if err != nil {
+		p.fail(err)
+		return
+	}
+	p.setStatus("已撤销: "+entry.Name, ChangeTracks)
+}
+
+func (p *Presenter) afterBlock(err error) {
+	if err != nil {
+		p.fail(err)
+	}
+	p.emit(ChangeTracks)
+}
+
+func (p *Presenter) BlockedEntries() []model.BlockEntry {
+	return p.blocklist.Entries()
+}
+
+// 手动切换离线模式
+func (p *Presenter) SetOffline(offline bool) {
+	model.SetOffline(offline)
+}
+
+func (p *Presenter) onOfflineChanged(offline bool) {
+	p.mu.Lock()
+	p.state.Offline = offline
+	model.MarkCached(p.state.Tracks)
+	p.mu.Unlock()
+	p.emit(ChangeOffline | ChangeTracks)
+}
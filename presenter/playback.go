@@ -0,0 +1,196 @@
+package presenter
+
+import (
+	"fmt"
+	"time"
+	"wander/model"
+)
+
+// 加载并播放第idx首，正在播放这首时暂停；下载期间会阻塞
+func (p *Presenter) Play(idx int) {
+	if err := p.play(idx); err != nil {
+		p.fail(err)
+	}
+}
+
+func (p *Presenter) play(idx int) error {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.state.Tracks) {
+		p.mu.Unlock()
+		return nil
+	}
+	music := p.state.Tracks[idx]
+	info := music.Info
+	if !model.IsAvailable(info) {
+		p.mu.Unlock()
+		return fmt.Errorf("离线不可播放: %s", info.Name)
+	}
+	p.state.TrackIdx = idx
+	p.playSeq++
+	seq := p.playSeq
+	p.mu.Unlock()
+	p.setStatus("加载 "+info.Name+"…", ChangeSelection)
+
+	if err := p.load(music); err != nil {
+		return fmt.Errorf("加载失败: %w", err)
+	}
+	p.mu.Lock()
+	if seq != p.playSeq {
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+	p.setStatus("", ChangeSelection)
+
+	action := model.Action(model.ActionPlay)
+	if p.pm.IsPlaying() && sameTrack(p.pm.Info(), info) {
+		action = model.ActionPause
+	}
+	if err := p.pm.Play(music, action, -1); err != nil {
+		return fmt.Errorf("播放失败: %w", err)
+	}
+	return nil
+}
+
+// 解析歌曲ID、本地文件或播放列表文件，替换歌曲列表并播放第一首；会阻塞
+func (p *Presenter) PlayTarget(target string) error {
+	musics, err := model.ResolveTracks(target)
+	if err == nil {
+		p.pm.Stop()
+		p.SetTracks(musics)
+		err = p.play(0)
+	}
+	if err != nil {
+		p.fail(err)
+	}
+	return err
+}
+
+// 暂停或继续，没有加载歌曲时播放选中的歌曲
+func (p *Presenter) Toggle() {
+	if info := p.pm.Info(); info.ID == "" && info.MusicLocal == "" {
+		p.mu.Lock()
+		idx := p.state.TrackIdx
+		p.mu.Unlock()
+		p.Play(idx)
+		return
+	}
+	action := model.Action(model.ActionPause)
+	if !p.pm.IsPlaying() {
+		action = model.ActionPlay
+	}
+	p.pm.Play(nil, action, -1)
+}
+
+func (p *Presenter) Pause() {
+	if p.pm.IsPlaying() {
+		p.pm.Play(nil, model.ActionPause, -1)
+	}
+}
+
+// 停止播放，正在下载的歌曲完成后也不再播放
+func (p *Presenter) Stop() {
+	p.mu.Lock()
+	p.playSeq++
+	p.mu.Unlock()
+	p.pm.Stop()
+}
+
+// 下一首，漫游时获取新的歌曲；会阻塞
+func (p *Presenter) Next() {
+	p.next(false)
+}
+
+// auto为true时表示当前歌曲播放结束自动切换
+func (p *Presenter) next(auto bool) {
+	p.mu.Lock()
+	radio := p.state.Chart == RadioID
+	tracks, cur, mode := p.state.Tracks, p.playingIndex(), p.state.Mode
+	p.mu.Unlock()
+	p.pm.Stop()
+
+	if radio {
+		p.setStatus("漫游中…", 0)
+		music, err := p.radio.Next()
+		if err != nil {
+			p.fail(fmt.Errorf("漫游失败: %w", err))
+			return
+		}
+		music.Source = RadioID
+		p.mu.Lock()
+		if p.state.Chart != RadioID {
+			p.mu.Unlock()
+			return
+		}
+		p.state.Tracks = append(p.state.Tracks, music)
+		idx := len(p.state.Tracks) - 1
+		p.mu.Unlock()
+		p.emit(ChangeTracks)
+		p.Play(idx)
+		return
+	}
+	if mode == model.PlayModeRepeatOne && !auto {
+		mode = model.PlayModeOrder
+	}
+	p.Play(p.ranker.NextIndex(tracks, cur, 1, mode))
+}
+
+// 上一首；会阻塞
+func (p *Presenter) Prev() {
+	p.mu.Lock()
+	tracks, cur, mode := p.state.Tracks, p.playingIndex(), p.state.Mode
+	p.mu.Unlock()
+	p.pm.Stop()
+
+	if mode == model.PlayModeRepeatOne {
+		mode = model.PlayModeOrder
+	}
+	p.Play(p.ranker.NextIndex(tracks, cur, -1, mode))
+}
+
+// 需持有锁，以播放器中的歌曲为准，回调可能还未处理
+func (p *Presenter) playingIndex() int {
+	if i := indexOf(p.state.Tracks, p.pm.Info()); i >= 0 {
+		return i
+	}
+	return p.state.TrackIdx
+}
+
+// 相对当前位置快进或快退
+func (p *Presenter) SeekBy(d time.Duration) {
+	p.pm.SeekBy(d)
+	p.updateProgress()
+}
+
+// 定位到pos采样处并播放
+func (p *Presenter) SeekTo(pos int) {
+	p.pm.Play(nil, model.ActionPlay, pos)
+	p.updateProgress()
+}
+
+// 设置音量，0-100
+func (p *Presenter) SetVolume(volume int) {
+	p.pm.SetVolume(volume)
+	p.mu.Lock()
+	changed := p.state.Volume != p.pm.Volume()
+	p.state.Volume = p.pm.Volume()
+	p.mu.Unlock()
+	if changed {
+		p.emit(ChangeVolume)
+	}
+}
+
+func (p *Presenter) SetMode(mode model.PlayMode) {
+	p.mu.Lock()
+	p.state.Mode = mode
+	p.mu.Unlock()
+	p.emit(ChangeMode)
+}
+
+// 切换到下一个播放模式
+func (p *Presenter) CycleMode() {
+	p.mu.Lock()
+	mode := (p.state.Mode + 1) % 3
+	p.mu.Unlock()
+	p.SetMode(mode)
+}
@@ -0,0 +1,504 @@
+package presenter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lauthrul/goutil/log"
+	"sync"
+	"time"
+	"wander/model"
+)
+
+// 与界面库无关的播放器逻辑：歌单、歌曲列表、选中项、正在播放、进度、加载状态和错误都保存在State中，
+// 变化时通知界面。窗口界面和终端界面只负责显示State并把用户操作转给Presenter。
+// 方法可在任意goroutine调用，注释中标明会阻塞的方法需要下载，界面应在后台调用。
+
+// 随机漫游
+const RadioID = "radio"
+
+// 变化的状态，界面据此刷新对应的控件
+type Change uint
+
+const (
+	ChangeCharts     Change = 1 << iota // 歌单列表
+	ChangeTracks                        // 歌曲列表及其中的标记
+	ChangeSelection                     // 选中的歌单、歌曲及选中歌曲的封面
+	ChangeNowPlaying                    // 正在播放的歌曲、播放状态和歌词
+	ChangeProgress                      // 播放进度
+	ChangeMode                          // 播放模式
+	ChangeVolume                        // 音量
+	ChangeOffline                       // 离线模式
+	ChangeStatus                        // 提示信息或错误
+)
+
+type Chart struct {
+	ID   string
+	Name string
+}
+
+type NowPlaying struct {
+	Info    model.MusicInfo
+	Playing bool
+	Lyric   model.LyricLine // 当前歌词，漫游的歌曲在歌词出现前为附带的评论
+}
+
+type Progress struct {
+	Pos      int // 采样数
+	Len      int
+	Position time.Duration
+	Duration time.Duration
+}
+
+type State struct {
+	Charts    []Chart
+	ChartIdx  int             // 选中的歌单
+	Chart     string          // 已打开的歌单ID
+	ChartLoad model.LoadState // 已打开歌单的加载状态
+	ChartErr  error
+	Tracks    []*model.Music
+	Movements map[string]model.RankMovement // 榜单排名变化
+	TrackIdx  int                           // 选中的歌曲
+	CoverLoad model.LoadState               // 选中歌曲封面的加载状态
+	CoverErr  error
+	Now       NowPlaying
+	Progress  Progress
+	Mode      model.PlayMode
+	Volume    int
+	Offline   bool
+	Status    string
+	Err       error // 最近一次操作的错误，有新的提示时清除
+}
+
+// 选中的歌曲，没有时返回nil
+func (s *State) Selected() *model.Music {
+	if s.TrackIdx < 0 || s.TrackIdx >= len(s.Tracks) {
+		return nil
+	}
+	return s.Tracks[s.TrackIdx]
+}
+
+// 正在播放的歌曲在列表中的位置，没有时为选中的位置
+func (s *State) PlayingIndex() int {
+	if i := indexOf(s.Tracks, s.Now.Info); i >= 0 {
+		return i
+	}
+	return s.TrackIdx
+}
+
+func indexOf(musics []*model.Music, info model.MusicInfo) int {
+	for i, m := range musics {
+		if sameTrack(m.Info, info) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 有ID时按ID比较，本地歌曲按路径比较
+func sameTrack(a, b model.MusicInfo) bool {
+	if b.ID != "" {
+		return a.ID == b.ID
+	}
+	return b.MusicLocal != "" && a.MusicLocal == b.MusicLocal
+}
+
+// 播放器，默认为model.PlayerManager
+type Player interface {
+	Play(music *model.Music, action model.Action, pos int) error
+	Stop()
+	Info() model.MusicInfo
+	IsPlaying() bool
+	Pos() int
+	Len() int
+	Duration(pos int) time.Duration
+	SeekBy(d time.Duration)
+	Volume() int
+	SetVolume(volume int)
+	UpdateInfo(music *model.Music, update func(info *model.MusicInfo)) // 与播放器读取互斥地修改歌曲信息
+}
+
+// 歌单存储，默认为model.PlaylistStore
+type Store interface {
+	List() []model.StoredPlaylist
+	Musics(id string) ([]*model.Music, error)
+}
+
+// 可替换的依赖，未设置的使用默认实现
+type Deps struct {
+	Player    Player
+	Playback  chan model.PlayCallback // Player的播放回调，与Player一起设置
+	Store     Store
+	LoadMusic func(info *model.MusicInfo) error // 下载歌曲，默认为model.LoadMusic
+}
+
+type Presenter struct {
+	pm         Player
+	chPlayback chan model.PlayCallback
+	store      Store
+	loadMusic  func(info *model.MusicInfo) error
+	favorites  *model.FavoriteStore
+	blocklist  *model.Blocklist
+	ranker     *model.Ranker
+	radio      *model.Radio
+	loader     *model.Loader
+
+	mu        sync.Mutex
+	state     State
+	chartLoad *model.Future // 未完成的歌单加载，完成时不是它则丢弃结果
+	coverLoad *model.Future
+	playSeq   int // 播放序号，下载完成时已切换到其他歌曲则不再播放
+	listeners []func(Change)
+}
+
+func New() *Presenter {
+	return NewWith(Deps{})
+}
+
+func NewWith(deps Deps) *Presenter {
+	p := &Presenter{pm: deps.Player, chPlayback: deps.Playback, store: deps.Store, loadMusic: deps.LoadMusic}
+	if p.loadMusic == nil {
+		p.loadMusic = model.LoadMusic
+	}
+
+	var err error
+	if p.favorites, err = model.NewFavoriteStore(); err != nil {
+		log.Error("load favorite store err:", err)
+	}
+	if p.store == nil {
+		store, err := model.NewPlaylistStore()
+		if err != nil {
+			log.Error("load playlist store err:", err)
+		}
+		store.AttachFavorites(p.favorites)
+		p.store = store
+	}
+	history, err := model.NewHistory()
+	if err != nil {
+		log.Error("load history err:", err)
+	}
+	if p.pm == nil {
+		p.chPlayback = make(chan model.PlayCallback)
+		pm := model.NewPlayerManager(p.chPlayback)
+		pm.SetHistory(history)
+		if scrobblers, err := model.LoadScrobblers(); err != nil {
+			log.Error("load scrobble config err:", err)
+		} else if len(scrobblers) > 0 {
+			sm, err := model.NewScrobbleManager(scrobblers...)
+			if err != nil {
+				log.Error("load scrobble queue err:", err)
+			}
+			sm.Run(pm.Subscribe(16))
+		}
+		p.pm = pm
+	}
+	if p.blocklist, err = model.NewBlocklist(); err != nil {
+		log.Error("load blocklist err:", err)
+	}
+	p.ranker = &model.Ranker{Blocklist: p.blocklist, History: history}
+	p.radio = model.NewRadio(model.DefaultRadioBuffer)
+	p.radio.SetRanker(p.ranker)
+	p.loader = model.NewLoader()
+
+	p.state.Volume = p.pm.Volume()
+	p.state.Offline = model.IsOffline()
+	p.reloadCharts()
+	model.OnOfflineChanged(p.onOfflineChanged)
+	go p.loop()
+	return p
+}
+
+// 注册状态变化的回调，f在后台goroutine中调用，不能阻塞，界面应转到UI线程后再读取State
+func (p *Presenter) OnChange(f func(Change)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, f)
+}
+
+func (p *Presenter) emit(c Change) {
+	p.mu.Lock()
+	listeners := append([]func(Change){}, p.listeners...)
+	p.mu.Unlock()
+	for _, f := range listeners {
+		f(c)
+	}
+}
+
+// 当前状态的副本
+func (p *Presenter) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.state
+	st.Charts = append([]Chart(nil), st.Charts...)
+	// 歌曲信息可能在后台被修改，只复制信息，不共享播放器使用的歌曲
+	st.Tracks = make([]*model.Music, len(p.state.Tracks))
+	for i, m := range p.state.Tracks {
+		st.Tracks[i] = &model.Music{Info: m.Info, Source: m.Source}
+	}
+	return st
+}
+
+func (p *Presenter) setStatus(status string, c Change) {
+	p.mu.Lock()
+	p.state.Status, p.state.Err = status, nil
+	p.mu.Unlock()
+	p.emit(c | ChangeStatus)
+}
+
+func (p *Presenter) fail(err error) {
+	log.Error(err)
+	p.mu.Lock()
+	p.state.Status, p.state.Err = "", err
+	p.mu.Unlock()
+	p.emit(ChangeStatus)
+}
+
+// 播放回调与定时刷新
+func (p *Presenter) loop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case playback := <-p.chPlayback:
+			p.onPlayback(playback)
+		case <-ticker.C:
+			if !p.pm.IsPlaying() {
+				continue
+			}
+			if pos, length := p.updateProgress(); length > 0 && pos >= length {
+				go p.next(true)
+			}
+		}
+	}
+}
+
+func (p *Presenter) onPlayback(playback model.PlayCallback) {
+	p.mu.Lock()
+	now := &p.state.Now
+	switch playback.Action {
+	case model.ActionNext:
+		p.mu.Unlock()
+		go p.next(true)
+		return
+	case model.ActionPlay, model.ActionPause:
+		if playback.Info.ID != now.Info.ID || playback.Info.MusicLocal != now.Info.MusicLocal {
+			now.Lyric = model.LyricLine{}
+			if f := playback.Info.Featured; f != nil {
+				now.Lyric.Text = f.NickName + "：" + f.Comments
+			}
+		}
+		now.Info, now.Playing = playback.Info, playback.Action == model.ActionPlay
+	case model.ActionStop:
+		*now = NowPlaying{}
+		p.state.Progress = Progress{}
+	case model.ActionLyric:
+		now.Lyric = playback.Lyric
+	default:
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.emit(ChangeNowPlaying | ChangeProgress)
+}
+
+func (p *Presenter) updateProgress() (pos, length int) {
+	pos, length = p.pm.Pos(), p.pm.Len()
+	p.mu.Lock()
+	p.state.Progress = Progress{Pos: pos, Len: length, Position: p.pm.Duration(pos), Duration: p.pm.Duration(length)}
+	p.mu.Unlock()
+	p.emit(ChangeProgress)
+	return pos, length
+}
+
+// 重新从歌单存储加载歌单列表
+func (p *Presenter) ReloadCharts() {
+	p.mu.Lock()
+	p.reloadCharts()
+	p.mu.Unlock()
+	p.emit(ChangeCharts | ChangeSelection)
+}
+
+func (p *Presenter) reloadCharts() {
+	var charts []Chart
+	for _, item := range p.store.List() {
+		charts = append(charts, Chart{ID: item.ID, Name: item.Name})
+	}
+	p.state.Charts = append(charts, Chart{ID: RadioID, Name: "随机漫游"})
+	if p.state.ChartIdx >= len(p.state.Charts) {
+		p.state.ChartIdx = len(p.state.Charts) - 1
+	}
+}
+
+func (p *Presenter) SelectChart(idx int) {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.state.Charts) || idx == p.state.ChartIdx {
+		p.mu.Unlock()
+		return
+	}
+	p.state.ChartIdx = idx
+	p.mu.Unlock()
+	p.emit(ChangeSelection)
+}
+
+// 打开选中的歌单，在后台加载，打开其他歌单时取消未完成的加载；漫游时清空列表，由Next添加歌曲
+func (p *Presenter) OpenChart() {
+	p.mu.Lock()
+	if p.state.ChartIdx < 0 || p.state.ChartIdx >= len(p.state.Charts) {
+		p.mu.Unlock()
+		return
+	}
+	item := p.state.Charts[p.state.ChartIdx]
+	// 重复打开正在加载的歌单时继续等待
+	if p.chartLoad != nil && p.chartLoad.Key == item.ID {
+		p.mu.Unlock()
+		return
+	}
+	p.state.Chart = item.ID
+	p.state.Tracks, p.state.Movements, p.state.TrackIdx = nil, nil, 0
+	p.dropChartLoad()
+	if item.ID == RadioID {
+		p.mu.Unlock()
+		p.radio.Start()
+		p.setStatus("随机漫游", ChangeTracks|ChangeSelection)
+		return
+	}
+	p.radio.Stop()
+	f := p.loader.Chart(p.store, item.ID)
+	p.chartLoad, p.state.ChartLoad = f, model.LoadLoading
+	p.mu.Unlock()
+	p.setStatus("加载 "+item.Name+"…", ChangeTracks|ChangeSelection)
+	go p.waitChart(f, item)
+}
+
+func (p *Presenter) waitChart(f *model.Future, item Chart) {
+	value, err := f.Wait()
+	if errors.Is(err, model.ErrCanceled) {
+		return
+	}
+	musics, _ := value.([]*model.Music)
+	for _, m := range musics {
+		m.Source = item.ID
+	}
+	movements := map[string]model.RankMovement{}
+	if list, err := model.ChartMovements(item.ID); err == nil {
+		for _, mv := range list {
+			movements[mv.ID] = mv
+		}
+	}
+
+	p.mu.Lock()
+	if p.chartLoad != f {
+		p.mu.Unlock()
+		return
+	}
+	p.chartLoad = nil
+	if err != nil {
+		p.state.ChartLoad, p.state.ChartErr = model.LoadFailed, err
+		p.mu.Unlock()
+		p.emit(ChangeTracks)
+		p.fail(fmt.Errorf("加载失败: %w", err))
+		return
+	}
+	p.state.ChartLoad = model.LoadDone
+	p.state.Tracks, p.state.Movements = musics, movements
+	p.mu.Unlock()
+	p.setStatus(fmt.Sprintf("%s，共%d首", item.Name, len(musics)), ChangeTracks|ChangeSelection)
+}
+
+// 下载到副本后写回，歌曲信息只在同时持有p.mu和播放器的锁时修改，
+// 持有任一个锁即可读取
+func (p *Presenter) load(music *model.Music) error {
+	p.mu.Lock()
+	info := music.Info
+	p.mu.Unlock()
+	if err := p.loadMusic(&info); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.pm.UpdateInfo(music, func(i *model.MusicInfo) { *i = info })
+	p.mu.Unlock()
+	return nil
+}
+
+// 需持有锁，丢弃正在加载的歌单
+func (p *Presenter) dropChartLoad() {
+	if p.chartLoad != nil {
+		p.chartLoad.Cancel()
+	}
+	p.chartLoad, p.state.ChartLoad, p.state.ChartErr = nil, model.LoadIdle, nil
+}
+
+// 替换歌曲列表，取消正在加载的歌单，停止漫游
+func (p *Presenter) SetTracks(musics []*model.Music) {
+	p.radio.Stop()
+	p.mu.Lock()
+	p.dropChartLoad()
+	p.state.Chart = ""
+	p.state.Tracks, p.state.Movements, p.state.TrackIdx = musics, nil, 0
+	p.mu.Unlock()
+	p.emit(ChangeTracks | ChangeSelection)
+}
+
+// 选中其他歌曲时取消未完成的封面下载
+func (p *Presenter) SelectTrack(idx int) {
+	p.mu.Lock()
+	if idx < 0 || idx >= len(p.state.Tracks) || idx == p.state.TrackIdx {
+		p.mu.Unlock()
+		return
+	}
+	p.state.TrackIdx = idx
+	p.dropCoverLoad()
+	p.mu.Unlock()
+	p.emit(ChangeSelection)
+}
+
+// 需持有锁
+func (p *Presenter) dropCoverLoad() {
+	if p.coverLoad != nil {
+		p.coverLoad.Cancel()
+	}
+	p.coverLoad, p.state.CoverLoad, p.state.CoverErr = nil, model.LoadIdle, nil
+}
+
+// 在后台下载选中歌曲的封面
+func (p *Presenter) LoadCover() {
+	p.mu.Lock()
+	music := p.state.Selected()
+	if music == nil {
+		p.mu.Unlock()
+		return
+	}
+	if music.Info.MusicPicLocal != "" {
+		p.dropCoverLoad()
+		p.state.CoverLoad = model.LoadDone
+		p.mu.Unlock()
+		p.emit(ChangeSelection)
+		return
+	}
+	f := p.loader.Cover(music.Info)
+	p.coverLoad, p.state.CoverLoad, p.state.CoverErr = f, model.LoadLoading, nil
+	p.mu.Unlock()
+	p.emit(ChangeSelection)
+
+	go func() {
+		value, err := f.Wait()
+		if errors.Is(err, model.ErrCanceled) {
+			return
+		}
+		p.mu.Lock()
+		if p.coverLoad != f {
+			p.mu.Unlock()
+			return
+		}
+		p.coverLoad = nil
+		if err != nil {
+			log.Error("load music pic err:", err)
+			p.state.CoverLoad, p.state.CoverErr = model.LoadFailed, err
+		} else {
+			path, _ := value.(string)
+			p.pm.UpdateInfo(music, func(info *model.MusicInfo) { info.MusicPicLocal = path })
+			p.state.CoverLoad = model.LoadDone
+		}
+		p.mu.Unlock()
+		p.emit(ChangeSelection)
+	}()
+}
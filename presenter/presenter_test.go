@@ -0,0 +1,316 @@
+package presenter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"wander/model"
+)
+
+// 只记录调用，不输出声音
+type fakePlayer struct {
+	mu      sync.Mutex
+	music   *model.Music
+	playing bool
+	played  []string // 开始播放的歌曲ID
+}
+
+func (f *fakePlayer) Play(music *model.Music, action model.Action, pos int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if music == nil {
+		music = f.music
+	}
+	f.music, f.playing = music, action == model.ActionPlay
+	if action == model.ActionPlay {
+		f.played = append(f.played, music.Info.ID)
+	}
+	return nil
+}
+
+func (f *fakePlayer) Stop() {
+	f.mu.Lock()
+	f.music, f.playing = nil, false
+	f.mu.Unlock()
+}
+
+func (f *fakePlayer) Info() model.MusicInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.music == nil {
+		return model.MusicInfo{}
+	}
+	return f.music.Info
+}
+
+func (f *fakePlayer) IsPlaying() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.playing
+}
+
+func (f *fakePlayer) Pos() int                       { return 0 }
+func (f *fakePlayer) Len() int                       { return -1 }
+func (f *fakePlayer) Duration(pos int) time.Duration { return 0 }
+func (f *fakePlayer) SeekBy(d time.Duration)         {}
+func (f *fakePlayer) Volume() int                    { return model.MaxVolume }
+func (f *fakePlayer) SetVolume(volume int)           {}
+
+func (f *fakePlayer) UpdateInfo(music *model.Music, update func(info *model.MusicInfo)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	update(&music.Info)
+}
+
+func (f *fakePlayer) history() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.played...)
+}
+
+// 歌单存储，设置了gate的歌单在gate关闭后才返回
+type fakeStore struct {
+	charts []model.StoredPlaylist
+	tracks map[string][]*model.Music
+	gates  map[string]chan struct{}
+}
+
+func (s *fakeStore) List() []model.StoredPlaylist {
+	return s.charts
+}
+
+func (s *fakeStore) Musics(id string) ([]*model.Music, error) {
+	if gate := s.gates[id]; gate != nil {
+		<-gate
+	}
+	tracks, ok := s.tracks[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	return tracks, nil
+}
+
+func testTracks(ids ...string) []*model.Music {
+	var musics []*model.Music
+	for _, id := range ids {
+		musics = append(musics, &model.Music{Info: model.MusicInfo{ID: id, Name: id, MusicLocal: id + ".mp3"}})
+	}
+	return musics
+}
+
+func newTestPresenter(t *testing.T, store *fakeStore, loadMusic func(*model.MusicInfo) error) (*Presenter, *fakePlayer) {
+	dataDir := model.DataDir
+	model.DataDir = t.TempDir()
+	t.Cleanup(func() { model.DataDir = dataDir })
+	if store == nil {
+		store = &fakeStore{}
+	}
+	if loadMusic == nil {
+		loadMusic = func(*model.MusicInfo) error { return nil }
+	}
+	player := &fakePlayer{}
+	p := NewWith(Deps{Player: player, Store: store, LoadMusic: loadMusic})
+	return p, player
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNextPrev(t *testing.T) {
+	p, player := newTestPresenter(t, nil, nil)
+	p.SetTracks(testTracks("a", "b", "c"))
+
+	p.Play(1)
+	p.Next()
+	p.Next() // 最后一首之后回到第一首
+	p.Prev()
+	p.Prev()
+	if got, want := player.history(), []string{"b", "c", "a", "c", "b"}; !equal(got, want) {
+		t.Errorf("order mode played %v, want %v", got, want)
+	}
+
+	// 单曲循环时手动切换按顺序，播放结束时重复当前歌曲
+	p.SetMode(model.PlayModeRepeatOne)
+	p.Next()
+	p.next(true)
+	p.Prev()
+	if got, want := player.history()[5:], []string{"c", "c", "b"}; !equal(got, want) {
+		t.Errorf("repeat one played %v, want %v", got, want)
+	}
+	if st := p.State(); st.TrackIdx != 1 {
+		t.Errorf("TrackIdx = %d, want 1", st.TrackIdx)
+	}
+}
+
+// 下载期间切换到其他歌曲或停止，下载完成后不再播放
+func TestPlaySuperseded(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		gates   = map[string]chan struct{}{}
+		started = make(chan string)
+	)
+	loadMusic := func(info *model.MusicInfo) error {
+		mu.Lock()
+		gate := gates[info.ID]
+		mu.Unlock()
+		if gate != nil {
+			started <- info.ID
+			<-gate
+		}
+		return nil
+	}
+	p, player := newTestPresenter(t, nil, loadMusic)
+	p.SetTracks(testTracks("a", "b", "c"))
+
+	play := func(idx int, id string) (release func()) {
+		gate := make(chan struct{})
+		mu.Lock()
+		gates[id] = gate
+		mu.Unlock()
+		done := make(chan struct{})
+		go func() {
+			p.Play(idx)
+			close(done)
+		}()
+		if got := <-started; got != id {
+			t.Fatalf("started %s, want %s", got, id)
+		}
+		return func() {
+			close(gate)
+			<-done
+		}
+	}
+
+	release := play(0, "a")
+	p.Play(1)
+	release()
+	if got, want := player.history(), []string{"b"}; !equal(got, want) {
+		t.Errorf("played %v, want %v", got, want)
+	}
+
+	release = play(2, "c")
+	p.Stop()
+	release()
+	if got, want := player.history(), []string{"b"}; !equal(got, want) {
+		t.Errorf("played %v after stop, want %v", got, want)
+	}
+	if player.IsPlaying() {
+		t.Error("player is playing after stop")
+	}
+}
+
+// 再次打开歌单时丢弃之前未完成的加载
+func TestOpenChartCanceled(t *testing.T) {
+	store := &fakeStore{
+		charts: []model.StoredPlaylist{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}, {ID: "c", Name: "C"}},
+		tracks: map[string][]*model.Music{"a": testTracks("a1"), "b": testTracks("b1", "b2")},
+		gates:  map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})},
+	}
+	p, _ := newTestPresenter(t, store, nil)
+
+	p.SelectChart(0)
+	p.OpenChart()
+	if st := p.State(); st.Chart != "a" || st.ChartLoad != model.LoadLoading || len(st.Tracks) != 0 {
+		t.Fatalf("after open a: chart %q load %v tracks %d", st.Chart, st.ChartLoad, len(st.Tracks))
+	}
+	p.SelectChart(1)
+	p.OpenChart()
+
+	close(store.gates["b"])
+	waitFor(t, "chart b", func() bool { return p.State().ChartLoad == model.LoadDone })
+	close(store.gates["a"])
+	time.Sleep(50 * time.Millisecond)
+
+	st := p.State()
+	if st.Chart != "b" || len(st.Tracks) != 2 || st.Tracks[0].Info.ID != "b1" {
+		t.Errorf("chart %q tracks %d, want b with 2 tracks", st.Chart, len(st.Tracks))
+	}
+	for _, m := range st.Tracks {
+		if m.Source != "b" {
+			t.Errorf("%s source = %q, want b", m.Info.ID, m.Source)
+		}
+	}
+
+	// 加载失败时记录错误
+	p.SelectChart(2)
+	p.OpenChart()
+	waitFor(t, "chart c", func() bool { return p.State().ChartLoad == model.LoadFailed })
+	if st := p.State(); !errors.Is(st.ChartErr, model.ErrNotFound) || st.Err == nil {
+		t.Errorf("ChartErr = %v, Err = %v", st.ChartErr, st.Err)
+	}
+}
+
+// 设置歌曲列表时取消正在加载的歌单
+func TestSetTracksCancelsChart(t *testing.T) {
+	store := &fakeStore{
+		charts: []model.StoredPlaylist{{ID: "a", Name: "A"}},
+		tracks: map[string][]*model.Music{"a": testTracks("a1")},
+		gates:  map[string]chan struct{}{"a": make(chan struct{})},
+	}
+	p, _ := newTestPresenter(t, store, nil)
+	p.OpenChart()
+	p.SetTracks(testTracks("x"))
+	close(store.gates["a"])
+	time.Sleep(50 * time.Millisecond)
+
+	st := p.State()
+	if st.Chart != "" || st.ChartLoad != model.LoadIdle || len(st.Tracks) != 1 || st.Tracks[0].Info.ID != "x" {
+		t.Errorf("chart %q load %v tracks %d, want the set tracks", st.Chart, st.ChartLoad, len(st.Tracks))
+	}
+}
+
+// 下载写回歌曲信息时其他goroutine同时读取状态
+func TestPlayUpdatesInfo(t *testing.T) {
+	loadMusic := func(info *model.MusicInfo) error {
+		info.MusicLocal = "cache/" + info.ID + ".mp3"
+		return nil
+	}
+	p, player := newTestPresenter(t, nil, loadMusic)
+	p.SetTracks(testTracks("a", "b"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			for _, m := range p.State().Tracks {
+				_ = m.Info.MusicLocal
+			}
+			if err := p.SaveSession(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	p.Play(0)
+	p.Play(1)
+	<-done
+
+	st := p.State()
+	if st.Tracks[0].Info.MusicLocal != "cache/a.mp3" || st.Tracks[1].Info.MusicLocal != "cache/b.mp3" {
+		t.Errorf("tracks = %+v, %+v", st.Tracks[0].Info, st.Tracks[1].Info)
+	}
+	if info := player.Info(); info.MusicLocal != "cache/b.mp3" {
+		t.Errorf("playing %+v", info)
+	}
+}
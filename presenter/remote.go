@@ -0,0 +1,39 @@
+package presenter
+
+import "wander/instance"
+
+// 处理其他进程转发的命令
+type remote struct{ p *Presenter }
+
+func (p *Presenter) Remote() instance.Controller {
+	return remote{p}
+}
+
+func (r remote) Play(target string) error {
+	return r.p.PlayTarget(target)
+}
+
+func (r remote) Next() error {
+	r.p.Next()
+	return nil
+}
+
+func (r remote) Prev() error {
+	r.p.Prev()
+	return nil
+}
+
+func (r remote) Toggle() error {
+	r.p.Toggle()
+	return nil
+}
+
+func (r remote) Pause() error {
+	r.p.Pause()
+	return nil
+}
+
+func (r remote) Stop() error {
+	r.p.Stop()
+	return nil
+}
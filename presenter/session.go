@@ -0,0 +1,75 @@
+package presenter
+
+import (
+	"github.com/lauthrul/goutil/log"
+	"time"
+	"wander/model"
+)
+
+// 定时保存播放状态
+func (p *Presenter) AutoSave() {
+	go func() {
+		for range time.Tick(model.SessionSaveInterval) {
+			if err := p.SaveSession(); err != nil {
+				log.Error("save session err:", err)
+			}
+		}
+	}()
+}
+
+func (p *Presenter) SaveSession() error {
+	p.mu.Lock()
+	session := &model.Session{
+		Index:  p.state.TrackIdx,
+		Mode:   p.state.Mode,
+		Volume: p.pm.Volume(),
+	}
+	if idx := p.state.ChartIdx; idx >= 0 && idx < len(p.state.Charts) {
+		session.Playlist = p.state.Charts[idx].ID
+	}
+	playing := p.pm.Info().ID
+	for i, m := range p.state.Tracks {
+		session.Queue = append(session.Queue, m.Info)
+		if playing != "" && m.Info.ID == playing {
+			session.Index = i
+			session.Pos = p.pm.Pos()
+			session.Position = p.pm.Duration(session.Pos)
+		}
+	}
+	p.mu.Unlock()
+	return model.SaveSession(session)
+}
+
+// 恢复上次的播放状态，歌曲以暂停状态定位到保存的位置；下载期间会阻塞
+func (p *Presenter) RestoreSession() error {
+	session, err := model.LoadSession()
+	if err != nil || session == nil {
+		return err
+	}
+
+	p.pm.SetVolume(session.Volume)
+	p.mu.Lock()
+	p.state.Mode = session.Mode
+	p.state.Volume = p.pm.Volume()
+	for i, item := range p.state.Charts {
+		if item.ID == session.Playlist {
+			p.state.ChartIdx, p.state.Chart = i, item.ID
+			break
+		}
+	}
+	// 使用保存的列表，取消正在加载的歌单
+	p.dropChartLoad()
+	p.state.Tracks, p.state.Movements = session.Musics(), nil
+	p.state.TrackIdx = session.Index
+	music := p.state.Selected()
+	p.mu.Unlock()
+	p.emit(ChangeMode | ChangeVolume | ChangeTracks | ChangeSelection)
+
+	if music == nil {
+		return nil
+	}
+	if err = p.load(music); err != nil {
+		return err
+	}
+	return p.pm.Play(music, model.ActionPause, session.Pos)
+}
@@ -0,0 +1,341 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"github.com/lauthrul/goutil/log"
+	"time"
+	"wander/instance"
+	"wander/model"
+	"wander/presenter"
+)
+
+const (
+	paneCharts = 0
+	paneTracks = 1
+
+	seekStep   = 5 * time.Second
+	volumeStep = 5
+
+	chartsWidth   = 24
+	nowPlayingRow = 7 // 底部播放区域占用的行数
+	coverWidth    = 14
+)
+
+const helpText = "Tab 切换  ↑↓ 选择  Enter 打开/播放  空格 播放/暂停  n/p 下一首/上一首  ←→ 快退/快进  +/- 音量  f 收藏  m 模式  b/B 屏蔽歌曲/歌手  u 撤销  o 离线  q 退出"
+
+// 终端界面，与窗口界面共用presenter.Presenter，只负责显示状态和处理按键
+type App struct {
+	screen tcell.Screen
+	p      *presenter.Presenter
+
+	// 以下状态只在事件循环中访问
+	chartOff int
+	trackOff int
+	focus    int
+	quit     bool
+
+	inst   *instance.Instance // 单实例锁，接收其他进程转发的命令
+	target string             // 启动时播放
+}
+
+func NewApp(p *presenter.Presenter) *App {
+	return &App{p: p}
+}
+
+// target不为空时启动后播放，见model.ResolveTracks
+func Run(target string) {
+	inst, err := instance.Acquire()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer inst.Release()
+
+	a := NewApp(presenter.New())
+	a.inst = inst
+	a.target = target
+	if err := a.Run(); err != nil {
+		log.Error("tui err:", err)
+		fmt.Println(err)
+	}
+}
+
+func (a *App) Run() error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err = screen.Init(); err != nil {
+		return err
+	}
+	a.screen = screen
+	defer screen.Fini()
+
+	// 状态变化转为界面事件，事件循环中重绘
+	a.p.OnChange(func(presenter.Change) {
+		a.post(func() {})
+	})
+	if a.inst != nil {
+		go a.inst.Serve(a.p.Remote())
+	}
+	if a.target != "" {
+		go a.p.PlayTarget(a.target)
+	} else {
+		go a.p.OpenChart()
+	}
+
+	for !a.quit {
+		a.draw()
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			a.onKey(ev)
+		case *tcell.EventInterrupt:
+			if f, ok := ev.Data().(func()); ok {
+				f()
+			}
+		case nil:
+			return nil
+		}
+	}
+	a.p.Stop()
+	return nil
+}
+
+// 在事件循环中执行f
+func (a *App) post(f func()) {
+	_ = a.screen.PostEvent(tcell.NewEventInterrupt(f))
+}
+
+func (a *App) move(delta int) {
+	st := a.p.State()
+	if a.focus == paneCharts {
+		a.p.SelectChart(clamp(st.ChartIdx+delta, 0, len(st.Charts)-1))
+		return
+	}
+	a.p.SelectTrack(clamp(st.TrackIdx+delta, 0, len(st.Tracks)-1))
+}
+
+func clamp(v, min, max int) int {
+	if v > max {
+		v = max
+	}
+	if v < min {
+		v = min
+	}
+	return v
+}
+
+func (a *App) onKey(ev *tcell.EventKey) {
+	_, h := a.screen.Size()
+	page := h - nowPlayingRow - 3
+	switch ev.Key() {
+	case tcell.KeyCtrlC, tcell.KeyEscape:
+		a.quit = true
+	case tcell.KeyTab, tcell.KeyBacktab:
+		a.focus = 1 - a.focus
+	case tcell.KeyUp:
+		a.move(-1)
+	case tcell.KeyDown:
+		a.move(1)
+	case tcell.KeyPgUp:
+		a.move(-page)
+	case tcell.KeyPgDn:
+		a.move(page)
+	case tcell.KeyHome:
+		a.move(-1 << 20)
+	case tcell.KeyEnd:
+		a.move(1 << 20)
+	case tcell.KeyLeft:
+		a.p.SeekBy(-seekStep)
+	case tcell.KeyRight:
+		a.p.SeekBy(seekStep)
+	case tcell.KeyEnter:
+		// 加载和下载在后台进行
+		if a.focus == paneCharts {
+			a.focus = paneTracks
+			go func() {
+				a.p.OpenChart()
+				if a.p.State().Chart == presenter.RadioID {
+					a.p.Next()
+				}
+			}()
+		} else {
+			idx := a.p.State().TrackIdx
+			go func() {
+				a.p.Stop()
+				a.p.Play(idx)
+			}()
+		}
+	case tcell.KeyRune:
+		a.onRune(ev.Rune())
+	}
+}
+
+func (a *App) onRune(r rune) {
+	switch r {
+	case 'q':
+		a.quit = true
+	case 'k':
+		a.move(-1)
+	case 'j':
+		a.move(1)
+	case ' ':
+		go a.p.Toggle()
+	case 'n':
+		go a.p.Next()
+	case 'p':
+		go a.p.Prev()
+	case '+', '=':
+		a.p.SetVolume(a.p.State().Volume + volumeStep)
+	case '-':
+		a.p.SetVolume(a.p.State().Volume - volumeStep)
+	case 'm':
+		a.p.CycleMode()
+	case 'o':
+		a.p.SetOffline(!model.IsManualOffline())
+	case 'f':
+		a.p.ToggleFavorite()
+	case 'b':
+		a.p.BlockTrack()
+	case 'B':
+		a.p.BlockArtist()
+	case 'u':
+		a.p.UndoBlock()
+	}
+}
+
+func (a *App) draw() {
+	s := a.screen
+	s.Clear()
+	w, h := s.Size()
+	if w < 40 || h < nowPlayingRow+5 {
+		drawText(s, 0, 0, w, styleDefault, "窗口太小")
+		s.Show()
+		return
+	}
+	st := a.p.State()
+
+	// 标题栏
+	title := "wander"
+	if st.Offline {
+		title += " [离线]"
+	}
+	title += fmt.Sprintf("  模式:%s  音量:%d", st.Mode, st.Volume)
+	drawLine(s, 0, 0, w, styleTitle, title)
+
+	// 歌单与歌曲列表
+	ph := h - nowPlayingRow - 2
+	cw := chartsWidth
+	if cw > w/3 {
+		cw = w / 3
+	}
+	a.drawCharts(&st, 0, 1, cw, ph)
+	a.drawTracks(&st, cw, 1, w-cw, ph)
+
+	a.drawNowPlaying(&st, 0, h-nowPlayingRow-1, w)
+
+	switch {
+	case st.Err != nil:
+		drawLine(s, 0, h-1, w, styleFocused, st.Err.Error())
+	case st.Status != "":
+		drawLine(s, 0, h-1, w, styleFocused, st.Status)
+	default:
+		drawLine(s, 0, h-1, w, styleDim, helpText)
+	}
+	s.Show()
+}
+
+func (a *App) paneStyle(pane int) tcell.Style {
+	if a.focus == pane {
+		return styleFocused
+	}
+	return styleDefault
+}
+
+func (a *App) drawCharts(st *presenter.State, x, y, w, h int) {
+	drawBox(a.screen, x, y, w, h, a.paneStyle(paneCharts), "歌单")
+	rows := h - 2
+	a.chartOff = scrollOffset(a.chartOff, st.ChartIdx, rows)
+	for i := 0; i < rows && a.chartOff+i < len(st.Charts); i++ {
+		idx := a.chartOff + i
+		style := styleDefault
+		if idx == st.ChartIdx {
+			style = styleSelected
+		}
+		name := st.Charts[idx].Name
+		if st.Charts[idx].ID == st.Chart {
+			name = "• " + name
+		}
+		drawLine(a.screen, x+1, y+1+i, w-2, style, name)
+	}
+}
+
+func (a *App) drawTracks(st *presenter.State, x, y, w, h int) {
+	drawBox(a.screen, x, y, w, h, a.paneStyle(paneTracks), "歌曲")
+	rows := h - 2
+	// 歌单在后台加载，列表为空时显示加载状态
+	if len(st.Tracks) == 0 && rows > 0 {
+		switch st.ChartLoad {
+		case model.LoadLoading:
+			drawLine(a.screen, x+1, y+1, w-2, styleDim, "加载中…")
+		case model.LoadFailed:
+			drawLine(a.screen, x+1, y+1, w-2, styleDim, "加载失败: "+st.ChartErr.Error())
+		}
+		return
+	}
+	a.trackOff = scrollOffset(a.trackOff, st.TrackIdx, rows)
+	playing := st.Now.Info.ID
+	for i := 0; i < rows && a.trackOff+i < len(st.Tracks); i++ {
+		idx := a.trackOff + i
+		info := st.Tracks[idx].Info
+		mark := " "
+		style := styleDefault
+		switch {
+		case a.p.IsBlocked(info):
+			mark, style = "✕", styleDim
+		case !model.IsAvailable(info):
+			mark, style = "⊘", styleDim
+		case playing != "" && info.ID == playing:
+			mark, style = "▶", stylePlaying
+		case a.p.IsFavorite(info.ID):
+			mark = "♥"
+		}
+		if idx == st.TrackIdx {
+			style = styleSelected
+		}
+		drawLine(a.screen, x+1, y+1+i, w-2, style, fmt.Sprintf("%s %03d %s - %s", mark, idx+1, info.Name, info.ArtistsName))
+	}
+}
+
+func (a *App) drawNowPlaying(st *presenter.State, x, y, w int) {
+	s := a.screen
+	now := st.Now
+
+	// 终端无法显示图片，以占位框代替封面
+	drawBox(s, x, y, coverWidth, nowPlayingRow, styleDim, "")
+	drawText(s, x+coverWidth/2-1, y+nowPlayingRow/2, 2, styleDim, "♪")
+
+	tx, tw := x+coverWidth+1, w-coverWidth-1
+	if now.Info.Name == "" {
+		drawLine(s, tx, y+1, tw, styleDim, "音乐的力量")
+	} else {
+		drawLine(s, tx, y, tw, styleTitle, now.Info.Name+" - "+now.Info.ArtistsName)
+		drawLine(s, tx, y+1, tw, styleDim, now.Info.AlbumName)
+		drawLine(s, tx, y+2, tw, styleDefault, now.Lyric.Text)
+		drawLine(s, tx, y+3, tw, styleDim, now.Lyric.Translation)
+
+		pg := st.Progress
+		times := fmt.Sprintf(" %s/%s", formatDuration(pg.Position), formatDuration(pg.Duration))
+		bar := progressBar(tw-len(times), pg.Pos, pg.Len)
+		drawLine(s, tx, y+4, tw, styleDefault, bar+times)
+	}
+
+	play := "[▶ 空格]"
+	if now.Playing {
+		play = "[|| 空格]"
+	}
+	drawLine(s, tx, y+5, tw, styleFocused, "[◀◀ p] "+play+" [▶▶ n]")
+}
@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+	"time"
+)
+
+var (
+	styleDefault  = tcell.StyleDefault
+	styleTitle    = tcell.StyleDefault.Bold(true)
+	styleSelected = tcell.StyleDefault.Reverse(true)
+	styleFocused  = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	styleDim      = tcell.StyleDefault.Foreground(tcell.ColorGray)
+	stylePlaying  = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+)
+
+// 在(x, y)处输出文本，最多占用width列，返回实际占用的列数
+func drawText(s tcell.Screen, x, y, width int, style tcell.Style, text string) int {
+	used := 0
+	for _, r := range text {
+		w := runewidth.RuneWidth(r)
+		if w == 0 {
+			continue
+		}
+		if used+w > width {
+			break
+		}
+		s.SetContent(x+used, y, r, nil, style)
+		used += w
+	}
+	return used
+}
+
+// 输出文本并用空格填满width列
+func drawLine(s tcell.Screen, x, y, width int, style tcell.Style, text string) {
+	used := drawText(s, x, y, width, style, text)
+	for i := used; i < width; i++ {
+		s.SetContent(x+i, y, ' ', nil, style)
+	}
+}
+
+func drawBox(s tcell.Screen, x, y, w, h int, style tcell.Style, title string) {
+	if w < 2 || h < 2 {
+		return
+	}
+	for i := x + 1; i < x+w-1; i++ {
+		s.SetContent(i, y, tcell.RuneHLine, nil, style)
+		s.SetContent(i, y+h-1, tcell.RuneHLine, nil, style)
+	}
+	for j := y + 1; j < y+h-1; j++ {
+		s.SetContent(x, j, tcell.RuneVLine, nil, style)
+		s.SetContent(x+w-1, j, tcell.RuneVLine, nil, style)
+	}
+	s.SetContent(x, y, tcell.RuneULCorner, nil, style)
+	s.SetContent(x+w-1, y, tcell.RuneURCorner, nil, style)
+	s.SetContent(x, y+h-1, tcell.RuneLLCorner, nil, style)
+	s.SetContent(x+w-1, y+h-1, tcell.RuneLRCorner, nil, style)
+	if title != "" {
+		drawText(s, x+2, y, w-4, style, " "+title+" ")
+	}
+}
+
+// 进度条 [=====>-----]
+func progressBar(width int, pos, length int) string {
+	if width < 3 {
+		return ""
+	}
+	inner := width - 2
+	filled := 0
+	if length > 0 && pos > 0 {
+		filled = int(float64(inner) * float64(pos) / float64(length))
+		if filled > inner {
+			filled = inner
+		}
+	}
+	bar := make([]rune, 0, width)
+	bar = append(bar, '[')
+	for i := 0; i < inner; i++ {
+		switch {
+		case i < filled:
+			bar = append(bar, '=')
+		case i == filled:
+			bar = append(bar, '>')
+		default:
+			bar = append(bar, '-')
+		}
+	}
+	return string(append(bar, ']'))
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// 让选中项保持在可视范围内
+func scrollOffset(offset, selected, height int) int {
+	if selected < offset {
+		return selected
+	}
+	if height > 0 && selected >= offset+height {
+		return selected - height + 1
+	}
+	return offset
+}
@@ -1,14 +1,14 @@
 package ui
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/lauthrul/goutil/log"
 	"github.com/lxn/walk"
 	. "github.com/lxn/walk/declarative"
 	"github.com/lxn/win"
-	"time"
+	"wander/instance"
 	"wander/model"
+	"wander/presenter"
 )
 
 const (
@@ -16,9 +16,13 @@ const (
 	textPause          = "||"
 	textPlayPrev       = "◀◀"
 	textPlayNext       = "▶▶"
+	textFavorite       = "♥"
+	textNotFavorite    = "♡"
 	textCurrentPlaying = "当前播放： <a>%s</a>"
+	textDefaultCover   = "img.jpg"
 )
 
+// 主窗口，只负责显示presenter的状态并转发用户操作
 type MyMainWindow struct {
 	*walk.MainWindow
 
@@ -28,72 +32,114 @@ type MyMainWindow struct {
 	lblCurrentPlaying *walk.LinkLabel
 	imgCover          *walk.ImageView
 	lblName           *walk.Label
+	lblLyric          *walk.Label
+	actOffline        *walk.Action
 	sl                *walk.Slider
+	slVolume          *walk.Slider
 	btnPrev           *walk.PushButton
 	btnPlay           *walk.PushButton
 	btnNext           *walk.PushButton
+	btnFavorite       *walk.PushButton
+	btnMode           *walk.PushButton
 
 	// data
 	playList  *PlaylistModel
 	musicList *MusicListModel
 
-	// manager
-	pm         *model.PlayerManager
-	chPlayback chan model.PlayCallback
+	p *presenter.Presenter
 }
 
-func (mw *MyMainWindow) init() {
-	go func() {
-		for {
-			select {
-			case playback := <-mw.chPlayback:
-				log.Debug(playback)
-				switch playback.Action {
-				case model.ActionStop:
-					// DO NOTHING
-				case model.ActionPlay, model.ActionPause:
-					text := textPause
-					if playback.Action == model.ActionPause {
-						text = textPlay
-					}
-					mw.btnPlay.SetText(text)
-				case model.ActionNext:
-					mw.onPlayNext()
-				}
-			case <-time.After(time.Second):
-				if !mw.pm.IsPlaying() {
-					continue
-				}
-
-				info := mw.pm.Info()
-				name := fmt.Sprintf("%s - %s", info.Name, info.ArtistsName)
-				pos := mw.pm.Pos()
-				length := mw.pm.Len()
-				text := fmt.Sprintf(textCurrentPlaying, name+fmt.Sprintf(" [%v/%v]", mw.pm.Duration(pos), mw.pm.Duration(length)))
-				log.Debug(text)
-				mw.lblCurrentPlaying.SetText(text)
-
-				mw.sl.SetRange(0, mw.pm.Len())
-				mw.sl.SendMessage(win.TBM_SETPOS, 1, uintptr(mw.pm.Pos()))
-
-				if pos >= length {
-					mw.onPlayNext()
-				}
-			}
+// 状态变化时在UI线程刷新对应的控件
+func (mw *MyMainWindow) onChange(c presenter.Change) {
+	mw.Synchronize(func() {
+		mw.render(c)
+	})
+}
+
+func (mw *MyMainWindow) render(c presenter.Change) {
+	st := mw.p.State()
+	if c&presenter.ChangeCharts != 0 {
+		mw.playList.items = st.Charts
+		mw.playList.PublishItemsReset()
+	}
+	if c&presenter.ChangeTracks != 0 {
+		mw.musicList.items = st.Tracks
+		mw.musicList.movements = st.Movements
+		switch st.ChartLoad {
+		case model.LoadLoading:
+			mw.musicList.placeholder = "加载中…"
+		case model.LoadFailed:
+			mw.musicList.placeholder = "加载失败: " + st.ChartErr.Error()
+		default:
+			mw.musicList.placeholder = ""
+		}
+		mw.musicList.PublishItemsReset()
+	}
+	if c&(presenter.ChangeCharts|presenter.ChangeTracks|presenter.ChangeSelection) != 0 {
+		if mw.lbPlayList.CurrentIndex() != st.ChartIdx {
+			mw.lbPlayList.SetCurrentIndex(st.ChartIdx)
+		}
+		if st.TrackIdx < len(st.Tracks) && mw.lbMusicList.CurrentIndex() != st.TrackIdx {
+			mw.lbMusicList.SetCurrentIndex(st.TrackIdx)
+		}
+		mw.updateControlPanel(&st)
+	}
+	if c&presenter.ChangeNowPlaying != 0 {
+		text := st.Now.Lyric.Text
+		if st.Now.Lyric.Translation != "" {
+			text += "\n" + st.Now.Lyric.Translation
+		}
+		mw.lblLyric.SetText(text)
+		mw.updateControlPanel(&st)
+	}
+	if c&presenter.ChangeProgress != 0 && st.Now.Playing {
+		info := st.Now.Info
+		name := fmt.Sprintf("%s - %s", info.Name, info.ArtistsName)
+		pg := st.Progress
+		mw.lblCurrentPlaying.SetText(fmt.Sprintf(textCurrentPlaying, name+fmt.Sprintf(" [%v/%v]", pg.Position, pg.Duration)))
+		mw.sl.SetRange(0, pg.Len)
+		mw.sl.SendMessage(win.TBM_SETPOS, 1, uintptr(pg.Pos))
+	}
+	if c&presenter.ChangeMode != 0 {
+		mw.btnMode.SetText(st.Mode.String())
+	}
+	if c&presenter.ChangeVolume != 0 && mw.slVolume.Value() != st.Volume {
+		mw.slVolume.SetValue(st.Volume)
+	}
+	if c&presenter.ChangeOffline != 0 {
+		title := "wander"
+		if st.Offline {
+			title += " [离线]"
 		}
-	}()
+		mw.SetTitle(title)
+	}
 }
 
-func (mw *MyMainWindow) updateControlPanel(music *model.Music) {
-	img, err := walk.NewImageFromFile(music.Info.MusicPicLocal)
+// 控制面板显示选中的歌曲
+func (mw *MyMainWindow) updateControlPanel(st *presenter.State) {
+	music := st.Selected()
+	if music == nil {
+		return
+	}
+	// 封面加载中或加载失败时显示默认图片
+	img, err := walk.Resources.Image(textDefaultCover)
+	if st.CoverLoad == model.LoadDone && music.Info.MusicPicLocal != "" {
+		img, err = walk.NewImageFromFile(music.Info.MusicPicLocal)
+	}
 	if err != nil {
 		log.Error("load music pic err:", err)
-		return
+	} else {
+		mw.imgCover.SetImage(img)
 	}
-	mw.imgCover.SetImage(img)
 	mw.lblName.SetText(music.Info.Name + " - " + music.Info.ArtistsName)
 
-	if mw.pm.IsPlaying() && mw.pm.Info().MusicLocal == music.Info.MusicLocal {
+	if mw.p.IsFavorite(music.Info.ID) {
+		mw.btnFavorite.SetText(textFavorite)
+	} else {
+		mw.btnFavorite.SetText(textNotFavorite)
+	}
+
+	if st.Now.Playing && st.Now.Info.MusicLocal == music.Info.MusicLocal {
 		mw.btnPlay.SetText(textPause)
 	} else {
 		mw.btnPlay.SetText(textPlay)
@@ -101,158 +147,102 @@ func (mw *MyMainWindow) updateControlPanel(music *model.Music) {
 }
 
 func (mw *MyMainWindow) onGotoTackList(link *walk.LinkLabelLink) {
-	idx := -1
-	for i, m := range mw.musicList.items {
-		if m.Info.ID == mw.pm.Info().ID {
-			idx = i
-			break
-		}
-	}
-	mw.lbMusicList.SetCurrentIndex(idx)
+	st := mw.p.State()
+	mw.p.SelectTrack(st.PlayingIndex())
 }
 
+// 歌单和封面在后台加载，加载状态随presenter的状态刷新
 func (mw *MyMainWindow) onPlaylistChanged() {
-	mw.Synchronize(func() {
-		idx := mw.lbPlayList.CurrentIndex()
-		if idx < 0 || idx >= len(mw.playList.items) {
-			return
-		}
-		item := mw.playList.items[idx]
-		url := fmt.Sprintf(model.Playlist, item.ID)
-		data, _, err := model.HttpDoTimeout(nil, "GET", url, nil, 30*time.Second)
-		if err != nil {
-			return
-		}
-		var playlist model.PlaylistResp
-		err = json.Unmarshal(data, &playlist)
-		if err != nil {
-			return
-		}
-		if playlist.Code != 200 {
-			log.Error(string(data))
-			return
-		}
-
-		mw.musicList.items = model.WalkPlaylist(&playlist)
-		mw.musicList.PublishItemsReset()
-	})
-}
-
-func (mw *MyMainWindow) onTrackListChanged() {
-	mw.Synchronize(func() {
-		var err error
-		idx := mw.lbMusicList.CurrentIndex()
-		if idx < 0 || idx >= len(mw.musicList.items) {
-			return
-		}
-		music := mw.musicList.items[idx]
-		fileName := fmt.Sprintf("%s-%s", music.Info.Name, music.Info.ArtistsName)
-		res, ok := model.CheckCaches("cache", fileName, model.CachePic)
-		if ok {
-			music.Info.MusicPicLocal = res[model.CachePic]
-		} else {
-			// download music pic
-			music.Info.MusicPicLocal, err = model.Download(music.Info.MusicPic, "/", fileName)
-			if err != nil {
-				return
-			}
-		}
-		mw.updateControlPanel(music)
-	})
-}
-
-func (mw *MyMainWindow) play(idx int) {
-	if idx < 0 || idx > len(mw.musicList.items) {
-		log.Error("playlist idx err:", idx)
+	idx := mw.lbPlayList.CurrentIndex()
+	st := mw.p.State()
+	if idx < 0 || idx >= len(st.Charts) {
 		return
 	}
-	music := mw.musicList.items[idx]
-	if music.Info.MusicLocal == "" {
-		fileName := fmt.Sprintf("%s-%s", music.Info.Name, music.Info.ArtistsName)
-		res, ok := model.CheckCaches("cache", fileName, model.CacheMusic)
-		if ok {
-			music.Info.MusicLocal = res[model.CacheMusic]
-		} else {
-			// download music
-			link := fmt.Sprintf(model.LinkUrl, music.Info.ID)
-			data, _, err := model.HttpDoTimeout(nil, "GET", link, nil, 2*time.Minute)
-			if err != nil {
-				return
-			}
-			var linkInfo model.LinkInfo
-			err = json.Unmarshal(data, &linkInfo)
-			if err != nil {
-				log.Error(err)
-				return
-			}
-			if linkInfo.Code != 200 {
-				log.Error(string(data))
-				return
-			}
-			music.Info.MusicUrl = linkInfo.Data.Url
-			music.Info.MusicLocal, err = model.Download(music.Info.MusicUrl, "/", fileName)
-			if err != nil {
-				return
-			}
-		}
-	}
-	// play music
-	action := model.Action(model.ActionPlay)
-	if music.IsPlaying() {
-		action = model.ActionPause
+	// 由状态同步引起的变化不重新加载
+	if idx == st.ChartIdx && st.Chart == st.Charts[idx].ID {
+		return
 	}
-	mw.pm.Play(music, action, -1)
+	mw.p.SelectChart(idx)
+	mw.p.OpenChart()
+}
+
+func (mw *MyMainWindow) onTrackListChanged() {
+	mw.p.SelectTrack(mw.lbMusicList.CurrentIndex())
+	mw.p.LoadCover()
 }
 
+// 播放需要下载，在后台调用，界面随状态变化刷新
 func (mw *MyMainWindow) onPlayPrev() {
-	mw.Synchronize(func() {
-		mw.pm.Stop()
-		idx := mw.lbMusicList.CurrentIndex() - 1
-		if idx < 0 {
-			idx = len(mw.musicList.items) - 1
-		}
-		mw.lbMusicList.SetCurrentIndex(idx)
-		mw.play(idx)
-	})
+	go mw.p.Prev()
 }
 
 func (mw *MyMainWindow) onPlay() {
-	mw.Synchronize(func() {
-		mw.play(mw.lbMusicList.CurrentIndex())
-	})
+	go mw.p.Play(mw.lbMusicList.CurrentIndex())
 }
 
 func (mw *MyMainWindow) onPlayNext() {
-	mw.Synchronize(func() {
-		mw.pm.Stop()
-		idx := mw.lbMusicList.CurrentIndex() + 1
-		max := len(mw.musicList.items) - 1
-		if idx > max {
-			idx = 0
-		}
-		mw.lbMusicList.SetCurrentIndex(idx)
-		mw.play(idx)
-	})
+	go mw.p.Next()
+}
+
+func (mw *MyMainWindow) onFavorite() {
+	mw.p.ToggleFavorite()
+}
+
+func (mw *MyMainWindow) onPlayMode() {
+	mw.p.CycleMode()
+}
+
+func (mw *MyMainWindow) onBlockTrack() {
+	mw.p.BlockTrack()
+}
+
+func (mw *MyMainWindow) onBlockArtist() {
+	mw.p.BlockArtist()
+}
+
+func (mw *MyMainWindow) onUndoBlock() {
+	mw.p.UndoBlock()
+}
+
+func (mw *MyMainWindow) onShowBlocked() {
+	text := ""
+	for _, e := range mw.p.BlockedEntries() {
+		text += fmt.Sprintf("[%s] %s\n", e.Kind, e.Name)
+	}
+	if text == "" {
+		text = "没有屏蔽的歌曲或歌手"
+	}
+	walk.MsgBox(mw, "已屏蔽", text, walk.MsgBoxIconInformation)
+}
+
+func (mw *MyMainWindow) onOffline() {
+	mw.p.SetOffline(mw.actOffline.Checked())
+}
+
+func (mw *MyMainWindow) onVolume() {
+	mw.p.SetVolume(mw.slVolume.Value())
 }
 
 func (mw *MyMainWindow) onPlayPos() {
-	mw.pm.Play(nil, model.ActionPlay, mw.sl.Value())
+	mw.p.SeekTo(mw.sl.Value())
 }
 
-func Run() {
+// target不为空时启动后播放，见model.ResolveTracks
+func Run(target string) {
+	inst, err := instance.Acquire()
+	if err != nil {
+		log.Error("acquire instance err:", err)
+		return
+	}
+	defer inst.Release()
 
 	walk.Resources.SetRootDirPath("cache")
 
-	mw := &MyMainWindow{
-		playList:   NewPlaylist(),
-		chPlayback: make(chan model.PlayCallback),
-	}
+	mw := &MyMainWindow{p: presenter.New()}
+	mw.playList = NewPlaylist(mw.p.State().Charts)
 	mw.musicList = NewTrackList(mw)
-	mw.pm = model.NewPlayerManager(mw.chPlayback)
 
-	mw.init()
-
-	MainWindow{
+	err = MainWindow{
 		AssignTo: &mw.MainWindow,
 		Title:    "wander",
 		MinSize:  Size{Width: 500, Height: 300},
@@ -286,6 +276,14 @@ func Run() {
 						Model:                 mw.playList,
 						CurrentIndex:          0,
 						OnCurrentIndexChanged: mw.onPlaylistChanged,
+						ContextMenuItems: []MenuItem{
+							Action{
+								AssignTo:    &mw.actOffline,
+								Text:        "离线模式",
+								Checkable:   true,
+								OnTriggered: mw.onOffline,
+							},
+						},
 					},
 					// 歌单
 					ListBox{
@@ -294,6 +292,13 @@ func Run() {
 						//MaxSize:  Size{Width: 200, Height: 32},
 						Model:                 mw.musicList,
 						OnCurrentIndexChanged: mw.onTrackListChanged,
+						ContextMenuItems: []MenuItem{
+							Action{Text: "屏蔽歌曲", OnTriggered: mw.onBlockTrack},
+							Action{Text: "屏蔽歌手", OnTriggered: mw.onBlockArtist},
+							Action{Text: "撤销屏蔽操作", OnTriggered: mw.onUndoBlock},
+							Separator{},
+							Action{Text: "已屏蔽…", OnTriggered: mw.onShowBlocked},
+						},
 					},
 				},
 			},
@@ -308,7 +313,7 @@ func Run() {
 					ImageView{
 						AssignTo: &mw.imgCover,
 						//Background: SolidColorBrush{Color: walk.RGB(0, 0, 0)},
-						Image: "img.jpg",
+						Image: textDefaultCover,
 						//MaxSize: Size{Width: 200, Height: 200},
 						MinSize: Size{Width: 200, Height: 200},
 						//Margin:  10,
@@ -320,14 +325,27 @@ func Run() {
 						//Font:      Font{Family: "微软雅黑", Bold: true},
 						Text: "音乐的力量",
 					},
+					// 歌词
+					Label{
+						AssignTo:  &mw.lblLyric,
+						Alignment: AlignHCenterVCenter,
+					},
 					Slider{
 						AssignTo:       &mw.sl,
 						Orientation:    Horizontal,
 						OnValueChanged: mw.onPlayPos,
 					},
+					// 音量
+					Slider{
+						AssignTo:       &mw.slVolume,
+						Orientation:    Horizontal,
+						MaxValue:       model.MaxVolume,
+						Value:          model.MaxVolume,
+						OnValueChanged: mw.onVolume,
+					},
 					Composite{
 						MaxSize: Size{0, 32},
-						Layout:  Grid{Columns: 4},
+						Layout:  Grid{Columns: 5},
 						Children: []Widget{
 							PushButton{
 								AssignTo:  &mw.btnPrev,
@@ -344,10 +362,46 @@ func Run() {
 								Text:      textPlayNext,
 								OnClicked: mw.onPlayNext,
 							},
+							PushButton{
+								AssignTo:  &mw.btnFavorite,
+								Text:      textNotFavorite,
+								OnClicked: mw.onFavorite,
+							},
+							PushButton{
+								AssignTo:  &mw.btnMode,
+								Text:      model.PlayModeOrder.String(),
+								OnClicked: mw.onPlayMode,
+							},
 						},
 					},
 				},
 			},
 		},
-	}.Run()
+	}.Create()
+	if err != nil {
+		log.Error("create main window err:", err)
+		return
+	}
+
+	mw.p.OnChange(mw.onChange)
+	mw.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		if err := mw.p.SaveSession(); err != nil {
+			log.Error("save session err:", err)
+		}
+	})
+	// 在首个歌单加载之后执行，覆盖为保存的列表
+	mw.Synchronize(func() {
+		go func() {
+			if err := mw.p.RestoreSession(); err != nil {
+				log.Error("restore session err:", err)
+			}
+			if target != "" {
+				mw.p.PlayTarget(target)
+			}
+		}()
+	})
+	mw.p.AutoSave()
+	go inst.Serve(remote{Controller: mw.p.Remote(), mw: mw})
+
+	mw.Run()
 }
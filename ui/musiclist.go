@@ -7,30 +7,56 @@ import (
 	"syscall"
 	"unsafe"
 	"wander/model"
+	"wander/presenter"
 )
 
 type MusicListModel struct {
 	walk.ListModelBase
-	items []*model.Music
+	p           *presenter.Presenter
+	items       []*model.Music
+	movements   map[string]model.RankMovement // 榜单排名变化
+	placeholder string                        // 列表为空时显示，如加载状态
 }
 
 func (m *MusicListModel) ItemCount() int {
+	if len(m.items) == 0 && m.placeholder != "" {
+		return 1
+	}
 	return len(m.items)
 }
 
 func (m *MusicListModel) Value(index int) interface{} {
-	return fmt.Sprintf("[%03d] %s - %s", index+1, m.items[index].Info.Name, m.items[index].Info.ArtistsName)
+	if len(m.items) == 0 {
+		return m.placeholder
+	}
+	text := fmt.Sprintf("[%03d] %s - %s", index+1, m.items[index].Info.Name, m.items[index].Info.ArtistsName)
+	if mv, ok := m.movements[m.items[index].Info.ID]; ok {
+		switch mv.Change {
+		case model.RankNew:
+			text += " [新]"
+		case model.RankUp:
+			text += fmt.Sprintf(" [↑%d]", mv.Delta)
+		case model.RankDown:
+			text += fmt.Sprintf(" [↓%d]", -mv.Delta)
+		}
+	}
+	if m.p.IsBlocked(m.items[index].Info) {
+		text = "✕ " + text
+	} else if !model.IsAvailable(m.items[index].Info) {
+		text = "⊘ " + text
+	}
+	return text
 }
 
 func NewTrackList(mw *MyMainWindow) *MusicListModel {
-	m := &MusicListModel{}
+	m := &MusicListModel{p: mw.p}
 	m.ItemsReset().Attach(func() {
 		mw.lbMusicList.SetSuspended(true)
 		defer mw.lbMusicList.SetSuspended(false)
 
 		mw.lbMusicList.SendMessage(win.LB_RESETCONTENT, 0, 0)
 
-		for i := 0; i < len(m.items); i++ {
+		for i := 0; i < m.ItemCount(); i++ {
 			str := m.Value(i)
 			lp := uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(str.(string))))
 			mw.lbMusicList.SendMessage(win.LB_INSERTSTRING, uintptr(i), lp)
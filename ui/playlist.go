@@ -1,15 +1,13 @@
 package ui
 
-import "github.com/lxn/walk"
-
-type PlaylistItem struct {
-	ID   string
-	Name string
-}
+import (
+	"github.com/lxn/walk"
+	"wander/presenter"
+)
 
 type PlaylistModel struct {
 	walk.ListModelBase
-	items []PlaylistItem
+	items []presenter.Chart
 }
 
 func (m *PlaylistModel) ItemCount() int {
@@ -20,13 +18,6 @@ func (m *PlaylistModel) Value(index int) interface{} {
 	return m.items[index].Name
 }
 
-func NewPlaylist() *PlaylistModel {
-	return &PlaylistModel{
-		items: []PlaylistItem{
-			{ID: "2250011882", Name: "抖音排行榜"},
-			{ID: "3778678", Name: "云音乐热歌榜"},
-			{ID: "3779629", Name: "云音乐新歌榜"},
-			{ID: "19723756", Name: "云音乐飙升榜"},
-		},
-	}
+func NewPlaylist(items []presenter.Chart) *PlaylistModel {
+	return &PlaylistModel{items: items}
 }
@@ -0,0 +1,23 @@
+package ui
+
+import (
+	"github.com/lxn/win"
+	"wander/instance"
+)
+
+// 处理其他进程转发的命令，再次启动时显示已有的窗口
+type remote struct {
+	instance.Controller
+	mw *MyMainWindow
+}
+
+func (r remote) Show() {
+	mw := r.mw
+	mw.Synchronize(func() {
+		mw.Show()
+		if win.IsIconic(mw.Handle()) {
+			win.ShowWindow(mw.Handle(), win.SW_RESTORE)
+		}
+		win.SetForegroundWindow(mw.Handle())
+	})
+}